@@ -0,0 +1,157 @@
+package gna
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	maxRejecting  = 64              // connections being told why they were rejected at once
+	rejectTimeout = 2 * time.Second // to tell them
+)
+
+/*Admission limits the connections a Server takes, a connection over the
+limits is rejected before any goroutine is started for it and the client
+gets the reason as a DisconnectError with DisconnectRejected. Zero means
+there's no limit.*/
+type Admission struct {
+	MaxPlayers  int           // connected players, authenticated or not
+	MaxPending  int           // players going through Auth at once
+	MaxPerIP    int           // connections from the same IP address
+	AuthTimeout time.Duration // to get through Auth, the player is closed after it
+	/*Reject is called first for every connection, a non-nil error
+	rejects it and its message is sent to the client*/
+	Reject func(addr net.Addr) error
+}
+
+/*SetAdmission sets the limits of the connections accepted after the call*/
+func (s *Server) SetAdmission(a Admission) {
+	s.mu.Lock()
+	s.adm = a
+	s.mu.Unlock()
+}
+
+func (s *Server) admission() Admission {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.adm
+}
+
+/*screen checks the ban list, runs the Reject hook and checks the limits of
+the admission. If the connection is let in it takes its place in the limits
+and is returned wrapped, so closing it gives the place back, otherwise the
+reason is returned. The caller must call authDone once the connection is
+done with the auth.*/
+func (s *Server) screen(conn net.Conn) (net.Conn, string) {
+	if b := s.banList(); b != nil {
+		if err := b.Check(conn.RemoteAddr()); err != nil {
+			return conn, err.Error()
+		}
+	}
+	adm := s.admission()
+	if adm.Reject != nil {
+		if err := adm.Reject(conn.RemoteAddr()); err != nil {
+			return conn, err.Error()
+		}
+	}
+	ip := hostOf(conn.RemoteAddr())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case adm.MaxPlayers > 0 && s.players.Len() >= adm.MaxPlayers:
+		return conn, "server full"
+	case adm.MaxPending > 0 && s.pending >= adm.MaxPending:
+		return conn, "too many pending connections"
+	case adm.MaxPerIP > 0 && s.perIP[ip] >= adm.MaxPerIP:
+		return conn, "too many connections from " + ip
+	}
+	s.pending++
+	s.perIP[ip]++
+	return &countedConn{Conn: conn, release: func() {
+		s.mu.Lock()
+		if s.perIP[ip]--; s.perIP[ip] <= 0 {
+			delete(s.perIP, ip)
+		}
+		s.mu.Unlock()
+	}}, ""
+}
+
+/*authDone gives back the place of a connection among the pending ones*/
+func (s *Server) authDone() {
+	s.mu.Lock()
+	s.pending--
+	s.mu.Unlock()
+}
+
+/*reject tells the client why it was refused and closes the connection,
+when too many are being told at once the connection is just closed*/
+func (s *Server) reject(p *Player, reason string) {
+	p.setReason(DisconnectRejected)
+	p.kickMsg = reason
+	select {
+	case s.rejecting <- struct{}{}:
+	default:
+		p.Close()
+		return
+	}
+	go func() {
+		defer func() { <-s.rejecting }()
+		c := p.conn
+		deadline := time.Now().Add(rejectTimeout)
+		c.SetDeadline(deadline)
+		p.enc.Encode(disconnect{Reason: DisconnectRejected, Message: reason})
+		// closing with unread data would reset the connection,
+		// and the client could miss the reason
+		if cw, ok := c.(interface{ CloseWrite() error }); ok && cw.CloseWrite() == nil {
+			io.Copy(io.Discard, io.LimitReader(c, 64<<10))
+		}
+		p.Close()
+	}()
+}
+
+/*authTimer closes the player if it's still going through the auth once
+the AuthTimeout elapses, the returned function stops the timer and
+reports if it went off, it can be called more than once. It does nothing
+if there's no timeout.*/
+func authTimer(p *Player, d time.Duration) (stop func() bool) {
+	if d <= 0 {
+		return func() bool { return false }
+	}
+	t := time.AfterFunc(d, func() {
+		p.setReason(DisconnectTimeout)
+		p.final.Store(true)
+		p.closeConn()
+	})
+	var once sync.Once
+	var fired bool
+	return func() bool {
+		once.Do(func() { fired = !t.Stop() })
+		return fired
+	}
+}
+
+/*countedConn gives back its place in the per IP count when closed*/
+type countedConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+/*hostOf returns the IP of the address, or the whole address if it has no port*/
+func hostOf(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
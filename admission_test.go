@@ -0,0 +1,98 @@
+package gna
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+/*dialRejected dials expecting to be rejected, returning the reason*/
+func dialRejected(t *testing.T, addr string) string {
+	t.Helper()
+	_, err := Dial(addr, WithHandshake(func(c *Client) error {
+		_, err := c.Recv()
+		return err
+	}))
+	var de *DisconnectError
+	if !errors.As(err, &de) || de.Reason != DisconnectRejected {
+		t.Fatal("not rejected:", err)
+	}
+	return de.Message
+}
+
+/*dialAdmitted dials and waits for the server to count the player*/
+func dialAdmitted(t *testing.T, srv *Server, addr string) *Client {
+	t.Helper()
+	n := srv.players.Len()
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.Start()
+	waitFor(t, "the player", func() bool { return srv.players.Len() == n+1 })
+	return c
+}
+
+/*admitted returns the players going through Auth and the IPs counted*/
+func admitted(srv *Server) (pending, ips int) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.pending, len(srv.perIP)
+}
+
+func waitReleased(t *testing.T, srv *Server) {
+	t.Helper()
+	waitFor(t, "the places to be given back", func() bool {
+		pending, ips := admitted(srv)
+		return pending == 0 && ips == 0 && srv.players.Len() == 0
+	})
+}
+
+func TestAdmission(t *testing.T) {
+	srv, addr := serveTest(t, &testIns{})
+	srv.SetAdmission(Admission{MaxPerIP: 1})
+	c := dialAdmitted(t, srv, addr)
+	if msg := dialRejected(t, addr); msg != "too many connections from 127.0.0.1" {
+		t.Fatal(msg)
+	}
+	c.Close()
+	waitReleased(t, srv)
+	c = dialAdmitted(t, srv, addr)
+
+	srv.SetAdmission(Admission{MaxPlayers: 1})
+	if msg := dialRejected(t, addr); msg != "server full" {
+		t.Fatal(msg)
+	}
+	srv.SetAdmission(Admission{Reject: func(net.Addr) error { return errors.New("go away") }})
+	if msg := dialRejected(t, addr); msg != "go away" {
+		t.Fatal(msg)
+	}
+	c.Close()
+	waitReleased(t, srv)
+}
+
+/*silentIns waits in Auth for a message that never comes*/
+type silentIns struct{ testIns }
+
+func (ins *silentIns) Auth(p *Player) { p.Recv() }
+
+func TestAdmissionPending(t *testing.T) {
+	srv, addr := serveTest(t, &silentIns{}, WithTimeouts(time.Minute, time.Minute))
+	srv.SetAdmission(Admission{MaxPending: 1, AuthTimeout: 200 * time.Millisecond})
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitFor(t, "the pending player", func() bool {
+		pending, _ := admitted(srv)
+		return pending == 1
+	})
+	if msg := dialRejected(t, addr); msg != "too many pending connections" {
+		t.Fatal(msg)
+	}
+	// the timeout closes the player stuck in Auth
+	waitReleased(t, srv)
+}
@@ -0,0 +1,281 @@
+package gna
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	/*ErrBadCredentials is returned by the Authenticators of gna
+	when the credentials are wrong*/
+	ErrBadCredentials = errors.New("gna: bad credentials")
+	/*ErrTokenExpired is returned by HMACToken for an expired token*/
+	ErrTokenExpired = errors.New("gna: token expired")
+	/*ErrShortKey is returned by HMACToken when its Key is shorter than MinKeyLen*/
+	ErrShortKey = errors.New("gna: hmac key too short")
+)
+
+/*AuthError refuses a player with a message meant for the client, see Authenticator*/
+type AuthError struct {
+	Message string
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+/*Identity is who a Player authenticated as, see Authenticator*/
+type Identity struct {
+	UserID string
+	Roles  []string
+}
+
+/*HasRole reports if the identity has the role*/
+func (id *Identity) HasRole(role string) bool {
+	if id == nil {
+		return false
+	}
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+/*Credentials are sent by a Client dialed WithCredentials, which of the
+fields are used depends on the Authenticator of the server*/
+type Credentials struct {
+	User   string
+	Secret string
+	Token  string
+}
+
+/*Authenticator checks the credentials of every player accepted by the
+listener of an Instance that has one (see WithAuthenticator), before the
+Auth of the instance. A non-nil error refuses the player, the client gets a
+DisconnectError with DisconnectRejected carrying the message of an *AuthError,
+ErrBadCredentials or ErrTokenExpired, other errors are only seen in
+Player.Error and the client is told the authentication failed. Otherwise
+the Identity is attached to the Player.*/
+type Authenticator interface {
+	Authenticate(p *Player, c Credentials) (*Identity, error)
+}
+
+/*AuthFunc adapts a function to an Authenticator, for custom
+stores of users*/
+type AuthFunc func(p *Player, c Credentials) (*Identity, error)
+
+/*Authenticate calls f(p, c)*/
+func (f AuthFunc) Authenticate(p *Player, c Credentials) (*Identity, error) {
+	return f(p, c)
+}
+
+/*SharedSecret accepts the clients that know the secret, they're
+identified by the User they claim and get the Roles given*/
+type SharedSecret struct {
+	Secret string
+	Roles  []string
+}
+
+/*Authenticate compares the secret in constant time*/
+func (s SharedSecret) Authenticate(p *Player, c Credentials) (*Identity, error) {
+	want := sha256.Sum256([]byte(s.Secret))
+	got := sha256.Sum256([]byte(c.Secret))
+	if subtle.ConstantTimeCompare(want[:], got[:]) != 1 {
+		return nil, ErrBadCredentials
+	}
+	return &Identity{UserID: c.User, Roles: s.Roles}, nil
+}
+
+/*HMACToken accepts the tokens it issued with the same Key, usually by
+another service, like a login server, sharing the key. The token carries
+the Identity and its expiry, signed with HMAC-SHA256. The Key must be at least
+MinKeyLen bytes long, otherwise every token is refused.*/
+type HMACToken struct {
+	Key []byte
+}
+
+/*MinKeyLen is the shortest Key HMACToken accepts*/
+const MinKeyLen = 32
+
+/*tokenClaims is the payload of a token, Exp is in unix seconds*/
+type tokenClaims struct {
+	User  string   `json:"sub"`
+	Roles []string `json:"roles,omitempty"`
+	Exp   int64    `json:"exp"`
+}
+
+/*Issue creates a token for the identity that expires after ttl*/
+func (h HMACToken) Issue(id Identity, ttl time.Duration) (string, error) {
+	if len(h.Key) < MinKeyLen {
+		return "", ErrShortKey
+	}
+	payload, err := json.Marshal(tokenClaims{
+		User:  id.UserID,
+		Roles: id.Roles,
+		Exp:   time.Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(h.sign(payload)), nil
+}
+
+/*Authenticate checks the signature and expiry of the token*/
+func (h HMACToken) Authenticate(p *Player, c Credentials) (*Identity, error) {
+	if len(h.Key) < MinKeyLen {
+		return nil, ErrShortKey
+	}
+	enc := base64.RawURLEncoding
+	payload, sig, ok := strings.Cut(c.Token, ".")
+	if !ok {
+		return nil, ErrBadCredentials
+	}
+	b, err1 := enc.DecodeString(payload)
+	s, err2 := enc.DecodeString(sig)
+	if err1 != nil || err2 != nil || !hmac.Equal(s, h.sign(b)) {
+		return nil, ErrBadCredentials
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return nil, ErrBadCredentials
+	}
+	if time.Now().Unix() >= claims.Exp {
+		return nil, ErrTokenExpired
+	}
+	return &Identity{UserID: claims.User, Roles: claims.Roles}, nil
+}
+
+func (h HMACToken) sign(payload []byte) []byte {
+	m := hmac.New(sha256.New, h.Key)
+	m.Write(payload)
+	return m.Sum(nil)
+}
+
+/*WithAuthenticator makes the listener of the instance authenticate the
+players before its Auth, the clients must be dialed WithCredentials*/
+func WithAuthenticator(a Authenticator) InstanceOption {
+	return func(n *Net) {
+		n.authn = a
+	}
+}
+
+func (n *Net) authenticator() Authenticator {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.authn
+}
+
+/*Identity returns who the player authenticated as,
+nil if the listener has no Authenticator*/
+func (p *Player) Identity() *Identity {
+	return p.ident
+}
+
+/*authenticate reads the credentials of the client and checks them, the
+player is refused and closed if they're wrong. It returns false if so.*/
+func (p *Player) authenticate(a Authenticator) bool {
+	dt, err := p.Recv()
+	if err != nil {
+		p.err = fmt.Errorf("auth: %w", err)
+		p.setReason(recvReason(err))
+		p.Close()
+		return false
+	}
+	l, ok := dt.(login)
+	if !ok {
+		err = fmt.Errorf("%w: expected credentials, got %T", ErrBadCredentials, dt)
+	} else {
+		p.ident, err = a.Authenticate(p, Credentials(l))
+	}
+	if err == nil && p.ident == nil {
+		err = ErrBadCredentials
+	}
+	if err != nil {
+		p.err = fmt.Errorf("auth: %w", err)
+		p.setReason(DisconnectRejected)
+		p.kickMsg = publicMessage(err)
+		p.Send(disconnect{Reason: DisconnectRejected, Message: p.kickMsg})
+		p.Close()
+		return false
+	}
+	if err := p.Send(loginOK{UserID: p.ident.UserID, Roles: p.ident.Roles}); err != nil {
+		p.err = fmt.Errorf("auth: %w", err)
+		p.Close()
+		return false
+	}
+	return true
+}
+
+/*publicMessage returns what the client may be told about the error,
+the errors of custom stores of users could reveal too much*/
+func publicMessage(err error) string {
+	var ae *AuthError
+	switch {
+	case errors.As(err, &ae):
+		return ae.Message
+	case errors.Is(err, ErrTokenExpired):
+		return ErrTokenExpired.Error()
+	case errors.Is(err, ErrBadCredentials):
+		return ErrBadCredentials.Error()
+	}
+	return "gna: authentication failed"
+}
+
+/*WithCredentials makes the Client present the credentials to the
+server on every new connection, see Authenticator. Dial fails with
+a DisconnectError if they're refused. The Secret travels as is,
+so use it with WithTLS.*/
+func WithCredentials(c Credentials) DialOption {
+	return func(cfg *dialConfig) {
+		cfg.creds = &c
+	}
+}
+
+/*Identity returns who the server authenticated the Client as,
+nil if it was not dialed WithCredentials*/
+func (c *Client) Identity() *Identity {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ident
+}
+
+/*login presents the credentials and waits for the server to accept them*/
+func (c *Client) login() error {
+	if c.cfg.creds == nil {
+		return nil
+	}
+	if err := c.dispatcher.Send(login(*c.cfg.creds)); err != nil {
+		return err
+	}
+	for {
+		dt, err := c.dispatcher.Recv()
+		if err != nil {
+			c.mu.Lock()
+			cause := c.cause
+			c.mu.Unlock()
+			if cause != nil {
+				return cause
+			}
+			return err
+		}
+		if v, ok := dt.(loginOK); ok {
+			c.mu.Lock()
+			c.ident = &Identity{UserID: v.UserID, Roles: v.Roles}
+			c.mu.Unlock()
+			return nil
+		}
+		if !c.control(dt) {
+			return fmt.Errorf("gna: expected the login answer, got %T", dt)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package gna
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, MinKeyLen)
+}
+
+func TestHMACToken(t *testing.T) {
+	h := HMACToken{Key: testKey('k')}
+	tok, err := h.Issue(Identity{UserID: "bob", Roles: []string{"admin"}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := h.Authenticate(nil, Credentials{Token: tok})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.UserID != "bob" || !id.HasRole("admin") || id.HasRole("player") {
+		t.Fatalf("identity %+v", id)
+	}
+
+	// another key
+	other := HMACToken{Key: testKey('x')}
+	if _, err := other.Authenticate(nil, Credentials{Token: tok}); err != ErrBadCredentials {
+		t.Fatal(err)
+	}
+	// a payload that's not the one signed
+	payload, sig, _ := strings.Cut(tok, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"eve","exp":9999999999}`))
+	if _, err := h.Authenticate(nil, Credentials{Token: forged + "." + sig}); err != ErrBadCredentials {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{"", payload, payload + ".", "!." + sig} {
+		if _, err := h.Authenticate(nil, Credentials{Token: bad}); err != ErrBadCredentials {
+			t.Fatalf("%q: %v", bad, err)
+		}
+	}
+}
+
+func TestHMACTokenExpiry(t *testing.T) {
+	h := HMACToken{Key: testKey('k')}
+	old, err := h.Issue(Identity{UserID: "bob"}, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Authenticate(nil, Credentials{Token: old}); err != ErrTokenExpired {
+		t.Fatal(err)
+	}
+}
+
+func TestHMACTokenShortKey(t *testing.T) {
+	for _, key := range [][]byte{nil, testKey('k')[1:]} {
+		h := HMACToken{Key: key}
+		if _, err := h.Issue(Identity{UserID: "bob"}, time.Hour); err != ErrShortKey {
+			t.Fatalf("issue with %d bytes: %v", len(key), err)
+		}
+		// even a token signed with the short key
+		payload := []byte(`{"sub":"bob","exp":9999999999}`)
+		enc := base64.RawURLEncoding
+		tok := enc.EncodeToString(payload) + "." + enc.EncodeToString(h.sign(payload))
+		if _, err := h.Authenticate(nil, Credentials{Token: tok}); err != ErrShortKey {
+			t.Fatalf("authenticate with %d bytes: %v", len(key), err)
+		}
+	}
+}
+
+func TestAuthenticateMessage(t *testing.T) {
+	errs := map[string]error{
+		"db":      errors.New("dial tcp 10.0.0.5:5432: connection refused"),
+		"banned":  &AuthError{Message: "banned until tomorrow"},
+		"expired": ErrTokenExpired,
+	}
+	ins := &testIns{}
+	_, addr := serveTest(t, ins, WithAuthenticator(AuthFunc(func(p *Player, c Credentials) (*Identity, error) {
+		return nil, errs[c.User]
+	})))
+	want := map[string]string{
+		"db":      "gna: authentication failed",
+		"banned":  "banned until tomorrow",
+		"expired": ErrTokenExpired.Error(),
+	}
+	for user, msg := range want {
+		_, err := Dial(addr, WithCredentials(Credentials{User: user}))
+		var de *DisconnectError
+		if !errors.As(err, &de) || de.Reason != DisconnectRejected || de.Message != msg {
+			t.Errorf("%s: got %v, want %q", user, err, msg)
+		}
+	}
+}
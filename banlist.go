@@ -0,0 +1,330 @@
+package gna
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	/*ErrBanned is the error of an address banned by the BanList*/
+	ErrBanned = errors.New("gna: banned")
+	/*ErrNotAllowed is the error of an address left out of the allow
+	rules of the BanList*/
+	ErrNotAllowed = errors.New("gna: address not allowed")
+	/*ErrNoBanList is returned by Player.Ban if the server has no BanList*/
+	ErrNoBanList = errors.New("gna: no ban list")
+)
+
+/*Rule bans or allows the addresses of a prefix until it expires,
+a zero Until never expires*/
+type Rule struct {
+	Prefix netip.Prefix
+	Allow  bool
+	Until  time.Time
+	Reason string
+}
+
+func (r Rule) active(now time.Time) bool {
+	return r.Until.IsZero() || now.Before(r.Until)
+}
+
+/*BanList decides which addresses may connect to the Server it's set to,
+see Server.SetBanList. An address is refused if a ban rule matches it or,
+when there are allow rules, if none of them does. The rules are saved to
+the file of the list on every change and adding a rule, or reloading the
+file, disconnects the players that no longer pass. It's safe for
+concurrent use.*/
+type BanList struct {
+	path  string
+	rules []Rule
+	srv   *Server
+	mu    sync.Mutex
+}
+
+/*NewBanList creates a BanList persisted to the file at path, loading its
+rules if the file exists. With an empty path the rules are kept in memory.*/
+func NewBanList(path string) (*BanList, error) {
+	b := &BanList{path: path}
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+/*Ban bans the IP address or CIDR for the duration given, forever if it's
+not positive. The reason is sent to the players that get disconnected and
+to the clients refused.*/
+func (b *BanList) Ban(cidr string, d time.Duration, reason string) error {
+	prefix, err := parsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	r := Rule{Prefix: prefix, Reason: reason}
+	if d > 0 {
+		r.Until = time.Now().Add(d)
+	}
+	return b.add(r)
+}
+
+/*Allow adds the IP address or CIDR to the allow rules, once there's
+one only the addresses matching them may connect*/
+func (b *BanList) Allow(cidr string) error {
+	prefix, err := parsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	return b.add(Rule{Prefix: prefix, Allow: true})
+}
+
+/*Remove deletes the rules of exactly the IP address or CIDR given*/
+func (b *BanList) Remove(cidr string) error {
+	prefix, err := parsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rules := b.rules[:0]
+	for _, r := range b.rules {
+		if r.Prefix != prefix {
+			rules = append(rules, r)
+		}
+	}
+	b.rules = rules
+	return b.save()
+}
+
+/*Rules returns the rules that did not expire*/
+func (b *BanList) Rules() []Rule {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	out := make([]Rule, 0, len(b.rules))
+	for _, r := range b.rules {
+		if r.active(now) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+/*Reload replaces the rules with the ones in the file, for when it's
+edited by hand, and disconnects the players that no longer pass*/
+func (b *BanList) Reload() error {
+	b.mu.Lock()
+	err := b.load()
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	b.enforce()
+	return nil
+}
+
+/*Check returns ErrBanned or ErrNotAllowed, wrapped with the reason, if the
+address may not connect. It fits Admission.Reject. Addresses that are
+not IPs, like those of pipes or unix sockets, pass.*/
+func (b *BanList) Check(addr net.Addr) error {
+	ip, err := netip.ParseAddr(hostOf(addr))
+	if err != nil {
+		return nil // no rule can match it
+	}
+	ip = ip.Unmap().WithZone("")
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	allowRules, allowed := false, false
+	for _, r := range b.rules {
+		if !r.active(now) {
+			continue
+		}
+		if r.Allow {
+			allowRules = true
+			allowed = allowed || r.Prefix.Contains(ip)
+			continue
+		}
+		if r.Prefix.Contains(ip) {
+			if r.Reason == "" {
+				return ErrBanned
+			}
+			return fmt.Errorf("%w: %s", ErrBanned, r.Reason)
+		}
+	}
+	if allowRules && !allowed {
+		return fmt.Errorf("%w: %v", ErrNotAllowed, ip)
+	}
+	return nil
+}
+
+/*add replaces the rule of the same prefix and kind, if any*/
+func (b *BanList) add(r Rule) error {
+	b.mu.Lock()
+	rules := b.rules[:0]
+	for _, old := range b.rules {
+		if old.Prefix != r.Prefix || old.Allow != r.Allow {
+			rules = append(rules, old)
+		}
+	}
+	b.rules = append(rules, r)
+	err := b.save()
+	b.mu.Unlock()
+	b.enforce()
+	return err
+}
+
+/*enforce disconnects the players of the server that do not pass the rules*/
+func (b *BanList) enforce() {
+	b.mu.Lock()
+	srv := b.srv
+	b.mu.Unlock()
+	if srv == nil {
+		return
+	}
+	var out []*Player
+	var errs []error
+	srv.players.each(func(p *Player) {
+		if err := b.Check(p.RemoteAddr()); err != nil {
+			out = append(out, p)
+			errs = append(errs, err)
+		}
+	})
+	for i, p := range out {
+		if !p.running.Load() {
+			// still going through the auth, which owns the connection
+			p.setReason(DisconnectKicked)
+			p.Close()
+			continue
+		}
+		p.Kick(errs[i].Error())
+	}
+}
+
+/*load reads the rules from the file, a missing file has none,
+it must be called with b.mu held*/
+func (b *BanList) load() error {
+	if b.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		b.rules = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("gna: ban list %v: %w", b.path, err)
+	}
+	b.rules = rules
+	return nil
+}
+
+/*save writes the rules that did not expire to the file, through a temporary
+file so it's never left half written, it must be called with b.mu held*/
+func (b *BanList) save() error {
+	if b.path == "" {
+		return nil
+	}
+	now := time.Now()
+	rules := make([]Rule, 0, len(b.rules))
+	for _, r := range b.rules {
+		if r.active(now) {
+			rules = append(rules, r)
+		}
+	}
+	data, err := json.MarshalIndent(rules, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+/*parsePrefix accepts an IP address or a CIDR*/
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return p, err
+		}
+		if p.Addr().Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		return p.Masked(), nil
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	ip = ip.Unmap().WithZone("")
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+/*SetBanList makes the server refuse the connections the list does not
+pass, before the Reject hook of the Admission, and disconnect the players
+that stop passing it. A nil list removes it.*/
+func (s *Server) SetBanList(b *BanList) {
+	s.mu.Lock()
+	s.bans = b
+	s.mu.Unlock()
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.srv = s
+	b.mu.Unlock()
+	b.enforce()
+}
+
+func (s *Server) banList() *BanList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bans
+}
+
+/*RemoteAddr returns the address of the client*/
+func (p *Player) RemoteAddr() net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn.RemoteAddr()
+}
+
+/*Ban bans the address of the player from the server for the duration
+given, forever if it's not positive, which disconnects it. With bits
+greater than zero the whole network of the address is banned, eg: 24 for
+an IPv4 /24. It returns ErrNoBanList if the server has no BanList.*/
+func (p *Player) Ban(d time.Duration, bits int, reason string) error {
+	var b *BanList
+	if p.srv != nil {
+		b = p.srv.banList()
+	}
+	if b == nil {
+		return ErrNoBanList
+	}
+	ip, err := netip.ParseAddr(hostOf(p.RemoteAddr()))
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap().WithZone("")
+	if bits <= 0 || bits > ip.BitLen() {
+		bits = ip.BitLen()
+	}
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		return err
+	}
+	return b.Ban(prefix.String(), d, reason)
+}
@@ -0,0 +1,150 @@
+package gna
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"10.0.0.1", "10.0.0.1/32"},
+		{"10.0.0.7/24", "10.0.0.0/24"},
+		{"::ffff:10.0.0.1", "10.0.0.1/32"},
+		{"::ffff:10.0.0.0/120", "10.0.0.0/24"},
+		{"fe80::1%eth0", "fe80::1/128"},
+		{"2001:db8::1/32", "2001:db8::/32"},
+	}
+	for _, tt := range tests {
+		p, err := parsePrefix(tt.in)
+		if err != nil || p.String() != tt.want {
+			t.Errorf("%s: got %v %v, want %s", tt.in, p, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "nope", "10.0.0.0/33", "10.0.0.1/"} {
+		if _, err := parsePrefix(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+func tcpAddr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}
+}
+
+func TestBanListCheck(t *testing.T) {
+	b, err := NewBanList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Ban("10.0.0.0/8", 0, "cheating")
+	b.Ban("11.0.0.1", time.Millisecond, "")
+	time.Sleep(5 * time.Millisecond)
+	tests := []struct {
+		addr net.Addr
+		want error
+	}{
+		{tcpAddr("10.1.2.3"), ErrBanned},
+		{tcpAddr("::ffff:10.1.2.3"), ErrBanned},
+		{tcpAddr("11.0.0.1"), nil}, // expired
+		{tcpAddr("192.168.1.1"), nil},
+		{&net.UnixAddr{Name: "/tmp/sock", Net: "unix"}, nil},
+	}
+	for _, tt := range tests {
+		if err := b.Check(tt.addr); !errors.Is(err, tt.want) || (err == nil) != (tt.want == nil) {
+			t.Errorf("%v: got %v, want %v", tt.addr, err, tt.want)
+		}
+	}
+	if err := b.Check(tcpAddr("10.1.2.3")); err.Error() != "gna: banned: cheating" {
+		t.Error(err)
+	}
+	if rules := b.Rules(); len(rules) != 1 || rules[0].Prefix.String() != "10.0.0.0/8" {
+		t.Error(rules)
+	}
+
+	// only the allowed addresses, the bans still apply
+	b.Allow("10.0.0.0/8")
+	b.Allow("192.168.0.0/16")
+	for addr, want := range map[string]error{
+		"192.168.1.1": nil,
+		"172.16.0.1":  ErrNotAllowed,
+		"10.1.2.3":    ErrBanned,
+	} {
+		if err := b.Check(tcpAddr(addr)); !errors.Is(err, want) || (err == nil) != (want == nil) {
+			t.Errorf("%v: got %v, want %v", addr, err, want)
+		}
+	}
+	b.Remove("10.0.0.0/8")
+	if err := b.Check(tcpAddr("10.1.2.3")); !errors.Is(err, ErrNotAllowed) {
+		t.Error("after Remove:", err)
+	}
+}
+
+func TestBanListPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	b, err := NewBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Ban("10.0.0.1", time.Hour, "spam")
+	b.Ban("10.0.0.2", time.Millisecond, "")
+	b.Allow("10.0.0.0/24")
+	time.Sleep(5 * time.Millisecond)
+	b.Ban("10.0.0.1", time.Hour, "spam") // saves without the expired rule
+
+	again, err := NewBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := again.Rules()
+	if len(rules) != 2 {
+		t.Fatal(rules)
+	}
+	for _, r := range rules {
+		if r.Allow && r.Prefix.String() != "10.0.0.0/24" ||
+			!r.Allow && (r.Prefix.String() != "10.0.0.1/32" || r.Reason != "spam" || r.Until.IsZero()) {
+			t.Errorf("loaded %+v", r)
+		}
+	}
+
+	// edited by hand
+	if err := os.WriteFile(path, []byte(`[{"Prefix": "10.0.0.3/32"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := again.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err := again.Check(tcpAddr("10.0.0.3")); !errors.Is(err, ErrBanned) {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, []byte("{"), 0o644)
+	if err := again.Reload(); err == nil {
+		t.Fatal("bad file reloaded")
+	}
+	if _, err := NewBanList(path); err == nil {
+		t.Fatal("bad file loaded")
+	}
+}
+
+func TestBanListEnforce(t *testing.T) {
+	ins := &testIns{}
+	srv, addr := serveTest(t, ins)
+	b, _ := NewBanList("")
+	srv.SetBanList(b)
+	c := dialAdmitted(t, srv, addr)
+	if err := b.Ban("127.0.0.1", 0, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, c)
+	var de *DisconnectError
+	if err := c.Error(); !errors.As(err, &de) || de.Reason != DisconnectKicked || de.Message != "gna: banned: bye" {
+		t.Fatal(err)
+	}
+	if msg := dialRejected(t, addr); msg != "gna: banned: bye" {
+		t.Fatal(msg)
+	}
+	waitFor(t, "Disconn", func() bool { return ins.disc.Load() == 1 })
+}
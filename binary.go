@@ -0,0 +1,477 @@
+package gna
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+/*The Binary codec writes each message as a frame:
+
+	uint32 length of the rest of the frame
+	uint16 length of the type name, followed by the registered name
+	the value
+
+values are encoded in big-endian with the following rules:
+
+	bool, int8, uint8: 1 byte
+	int16, uint16: 2 bytes
+	int32, uint32, float32: 4 bytes
+	int, uint, int64, uint64, float64: 8 bytes
+	string, slice, map: uint32 count followed by the elements (maps as key, value pairs)
+	array: the elements
+	struct: the exported fields in order of declaration
+	pointer: 1 byte (0 for nil, 1 otherwise) followed by the value
+	interface: uint16 length of the type name (0 for nil), the name and the value
+	encoding.BinaryMarshaler: uint32 length followed by the marshaled bytes
+*/
+type binaryCodec struct{}
+
+func (c binaryCodec) NewEncoder(w io.Writer) Encoder {
+	return frameEncoder{w, c}
+}
+
+func (binaryCodec) NewDecoder(r io.Reader) Decoder {
+	return &binaryDecoder{r: r}
+}
+
+var (
+	errShortFrame   = errors.New("binary: frame too short")
+	binaryMarshaler = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarsh   = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+/*marshalsItself reports if the type is encoded through its own
+MarshalBinary and UnmarshalBinary methods*/
+func marshalsItself(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
+		return false
+	}
+	return t.Implements(binaryMarshaler) && reflect.PtrTo(t).Implements(binaryUnmarsh)
+}
+
+func (binaryCodec) Frame(dt interface{}) ([]byte, error) {
+	e := &binaryEncoder{buf: make([]byte, 4, 64)}
+	err := e.iface(dt)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+	return e.buf, nil
+}
+
+type binaryEncoder struct {
+	buf []byte
+}
+
+func (e *binaryEncoder) iface(dt interface{}) error {
+	if dt == nil {
+		e.buf = binary.BigEndian.AppendUint16(e.buf, 0)
+		return nil
+	}
+	name, err := types.name(dt)
+	if err != nil {
+		return err
+	}
+	e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(len(name)))
+	e.buf = append(e.buf, name...)
+	return e.value(reflect.ValueOf(dt))
+}
+
+func (e *binaryEncoder) value(v reflect.Value) error {
+	if marshalsItself(v.Type()) {
+		b, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(len(b)))
+		e.buf = append(e.buf, b...)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+	case reflect.Int8:
+		e.buf = append(e.buf, byte(v.Int()))
+	case reflect.Uint8:
+		e.buf = append(e.buf, byte(v.Uint()))
+	case reflect.Int16:
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v.Int()))
+	case reflect.Uint16:
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v.Uint()))
+	case reflect.Int32:
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v.Int()))
+	case reflect.Uint32:
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v.Uint()))
+	case reflect.Int, reflect.Int64:
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint64:
+		e.buf = binary.BigEndian.AppendUint64(e.buf, v.Uint())
+	case reflect.Float32:
+		e.buf = binary.BigEndian.AppendUint32(e.buf, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v.Float()))
+	case reflect.String:
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v.Len()))
+		e.buf = append(e.buf, v.String()...)
+	case reflect.Slice:
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v.Len()))
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.buf = append(e.buf, v.Bytes()...)
+			return nil
+		}
+		return e.elems(v)
+	case reflect.Array:
+		return e.elems(v)
+	case reflect.Map:
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v.Len()))
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.value(iter.Key()); err != nil {
+				return err
+			}
+			if err := e.value(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if err := e.value(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0)
+			return nil
+		}
+		e.buf = append(e.buf, 1)
+		return e.value(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return e.iface(nil)
+		}
+		return e.iface(v.Elem().Interface())
+	default:
+		return fmt.Errorf("binary: unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+func (e *binaryEncoder) elems(v reflect.Value) error {
+	for i := 0; i < v.Len(); i++ {
+		if err := e.value(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type binaryDecoder struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (d *binaryDecoder) Decode() (interface{}, error) {
+	var err error
+	d.buf, err = readFrame(d.r, d.buf)
+	if err != nil {
+		return nil, err
+	}
+	s := &binaryState{b: d.buf, budget: -1}
+	if l := limitsOf(d.r); l != nil && l.limits.MaxAlloc > 0 {
+		s.budget = l.limits.MaxAlloc
+	}
+	return s.iface()
+}
+
+/*binaryState is the cursor over a single frame, budget is how many
+bytes may still be allocated, or -1 if there's no limit*/
+type binaryState struct {
+	b      []byte
+	budget int
+}
+
+/*alloc charges the allocation of n values of the type to the budget*/
+func (s *binaryState) alloc(t reflect.Type, n int) error {
+	size := int(t.Size())
+	if size == 0 {
+		size = 1
+	}
+	if s.budget >= 0 && n > s.budget/size {
+		return fmt.Errorf("%w: allocation budget exceeded", ErrMessageTooLarge)
+	}
+	return s.charge(n * size)
+}
+
+/*charge takes n bytes from the budget*/
+func (s *binaryState) charge(n int) error {
+	if s.budget < 0 {
+		return nil
+	}
+	if n > s.budget {
+		return fmt.Errorf("%w: allocation budget exceeded", ErrMessageTooLarge)
+	}
+	s.budget -= n
+	return nil
+}
+
+func (s *binaryState) next(n int) ([]byte, error) {
+	if n < 0 || len(s.b) < n {
+		return nil, errShortFrame
+	}
+	out := s.b[:n]
+	s.b = s.b[n:]
+	return out, nil
+}
+
+/*count reads the number of elements that follow, empty is true if the
+elements take no bytes, otherwise each of them takes at least one byte*/
+func (s *binaryState) count(empty bool) (int, error) {
+	b, err := s.next(4)
+	if err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint32(b))
+	if !empty && n > len(s.b) {
+		return 0, errShortFrame
+	}
+	return n, nil
+}
+
+/*encodesEmpty reports if the values of the type take no bytes,
+like struct{} or a struct with unexported fields only*/
+func encodesEmpty(t reflect.Type) bool {
+	if marshalsItself(t) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.IsExported() && !encodesEmpty(f.Type) {
+				return false
+			}
+		}
+		return true
+	case reflect.Array:
+		return t.Len() == 0 || encodesEmpty(t.Elem())
+	}
+	return false
+}
+
+func (s *binaryState) iface() (interface{}, error) {
+	b, err := s.next(2)
+	if err != nil {
+		return nil, err
+	}
+	b, err = s.next(int(binary.BigEndian.Uint16(b)))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, nil
+	}
+	t, err := types.typeOf(string(b))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.alloc(t, 1); err != nil {
+		return nil, err
+	}
+	v := reflect.New(t).Elem()
+	err = s.value(v)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+func (s *binaryState) value(v reflect.Value) error {
+	if marshalsItself(v.Type()) {
+		n, err := s.count(false)
+		if err != nil {
+			return err
+		}
+		b, err := s.next(n)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+	}
+	var size int
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		size = 1
+	case reflect.Int16, reflect.Uint16:
+		size = 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		size = 4
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Float64:
+		size = 8
+	}
+	if size > 0 {
+		b, err := s.next(size)
+		if err != nil {
+			return err
+		}
+		return s.scalar(v, b)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		n, err := s.count(false)
+		if err != nil {
+			return err
+		}
+		b, err := s.next(n)
+		if err != nil {
+			return err
+		}
+		if err := s.charge(n); err != nil {
+			return err
+		}
+		v.SetString(string(b))
+	case reflect.Slice:
+		empty := encodesEmpty(v.Type().Elem())
+		n, err := s.count(empty)
+		if err != nil {
+			return err
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := s.next(n)
+			if err != nil {
+				return err
+			}
+			if err := s.alloc(v.Type().Elem(), n); err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		if err := s.alloc(v.Type().Elem(), n); err != nil {
+			return err
+		}
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+		if empty {
+			return nil // there's nothing to read, the zero values are it
+		}
+		return s.elems(v)
+	case reflect.Array:
+		return s.elems(v)
+	case reflect.Map:
+		t := v.Type()
+		empty := encodesEmpty(t.Key()) && encodesEmpty(t.Elem())
+		n, err := s.count(empty)
+		if err != nil {
+			return err
+		}
+		if empty && n > 1 {
+			return errors.New("binary: repeated map key")
+		}
+		if err := s.alloc(t.Key(), n); err != nil {
+			return err
+		}
+		if err := s.alloc(t.Elem(), n); err != nil {
+			return err
+		}
+		v.Set(reflect.MakeMapWithSize(t, n))
+		for i := 0; i < n; i++ {
+			key := reflect.New(t.Key()).Elem()
+			if err := s.value(key); err != nil {
+				return err
+			}
+			val := reflect.New(t.Elem()).Elem()
+			if err := s.value(val); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, val)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if err := s.value(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		b, err := s.next(1)
+		if err != nil {
+			return err
+		}
+		if b[0] == 0 {
+			return nil
+		}
+		if err := s.alloc(v.Type().Elem(), 1); err != nil {
+			return err
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		return s.value(v.Elem())
+	case reflect.Interface:
+		dt, err := s.iface()
+		if err != nil {
+			return err
+		}
+		if dt == nil {
+			return nil
+		}
+		x := reflect.ValueOf(dt)
+		if !x.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("binary: %v is not assignable to %v", x.Type(), v.Type())
+		}
+		v.Set(x)
+	default:
+		return fmt.Errorf("binary: unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+func (s *binaryState) scalar(v reflect.Value, b []byte) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(b[0] != 0)
+	case reflect.Int8:
+		v.SetInt(int64(int8(b[0])))
+	case reflect.Uint8:
+		v.SetUint(uint64(b[0]))
+	case reflect.Int16:
+		v.SetInt(int64(int16(binary.BigEndian.Uint16(b))))
+	case reflect.Uint16:
+		v.SetUint(uint64(binary.BigEndian.Uint16(b)))
+	case reflect.Int32:
+		v.SetInt(int64(int32(binary.BigEndian.Uint32(b))))
+	case reflect.Uint32:
+		v.SetUint(uint64(binary.BigEndian.Uint32(b)))
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(b))))
+	case reflect.Int, reflect.Int64:
+		v.SetInt(int64(binary.BigEndian.Uint64(b)))
+	case reflect.Uint, reflect.Uint64:
+		v.SetUint(binary.BigEndian.Uint64(b))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(b)))
+	}
+	return nil
+}
+
+func (s *binaryState) elems(v reflect.Value) error {
+	for i := 0; i < v.Len(); i++ {
+		if err := s.value(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package gna
+
+import "fmt"
+
+/*Channel is a lane of the connection with its own priority, the worker
+of a Player or Client always writes the messages of the channel with the
+highest priority first. Messages of channels with a Chunk size are split
+in chunks of that many bytes, so they don't delay other channels for long,
+as long as the codec is a Framer. Declare channels once and reuse them.*/
+type Channel struct {
+	Name     string
+	Priority int // higher is written first
+	Chunk    int // zero to never split
+}
+
+var (
+	/*Control is used for the control messages of gna, like heartbeats and calls*/
+	Control = &Channel{Name: "control", Priority: 100}
+	/*Gameplay is the channel used by Dispatch*/
+	Gameplay = &Channel{Name: "gameplay", Priority: 50}
+	/*Bulk is meant for big payloads that are not urgent, like inventories*/
+	Bulk = &Channel{Name: "bulk", Priority: 0, Chunk: 16 << 10}
+)
+
+/*DispatchOn is like Dispatch, but on the channel given*/
+func (*Net) DispatchOn(ch *Channel, s shipper, data interface{}) {
+	s.shipOn(ch, data)
+}
+
+/*DispatchOn is like Dispatch, but on the channel given*/
+func (c *Client) DispatchOn(ch *Channel, data interface{}) {
+	if !c.started {
+		panic("cannot dispatch, client not started")
+	}
+	c.q.put(ch, c.split(ch, data), c.closedChan())
+}
+
+/*chunk is a piece of a message split by its channel, the receiver
+decodes the message once the Last chunk arrives*/
+type chunk struct {
+	ID   uint64
+	Last bool
+	Data []byte
+}
+
+/*bulk is what's left to write of a message being split*/
+type bulk struct {
+	ch   *Channel
+	id   uint64
+	b    []byte
+	size int
+}
+
+/*next returns the next chunk of the message*/
+func (b *bulk) next() chunk {
+	n := b.size
+	if n > len(b.b) {
+		n = len(b.b)
+	}
+	c := chunk{ID: b.id, Data: b.b[:n], Last: n == len(b.b)}
+	b.b = b.b[n:]
+	return c
+}
+
+/*split wraps the data in a bulk if it must be chunked*/
+func (p *dispatcher) split(ch *Channel, dt interface{}) interface{} {
+	if ch.Chunk <= 0 {
+		return dt
+	}
+	var b []byte
+	if f, ok := dt.(*frame); ok {
+		b = f.b
+	} else if f, ok := p.codec.(Framer); ok {
+		var err error
+		if b, err = f.Frame(dt); err != nil {
+			return dt // the worker will find the error on its own
+		}
+	}
+	if len(b) <= ch.Chunk {
+		return dt
+	}
+	return &bulk{ch: ch, id: p.bulkID.Add(1), b: b, size: ch.Chunk}
+}
+
+/*maxPartial is how many chunked messages a peer may have
+incomplete at once, the sender completes one per Channel at a time*/
+const maxPartial = 16
+
+/*assemble keeps the chunks of a message until it's complete, done is
+false while chunks are missing. Going over the limits is an error that
+leaves the partial messages behind, the connection must be closed.*/
+func (p *dispatcher) assemble(c chunk) (dt interface{}, done bool, err error) {
+	if p.chunks == nil {
+		p.chunks = make(map[uint64][]byte, 1)
+	}
+	old, ok := p.chunks[c.ID]
+	if !ok && len(p.chunks) >= maxPartial {
+		return nil, true, fmt.Errorf("%w: over %v partial messages", ErrMessageTooLarge, maxPartial)
+	}
+	b := append(old, c.Data...)
+	p.buffered += len(c.Data)
+	if err := p.in.checkSize(len(b)); err != nil {
+		return nil, true, err
+	}
+	if max := p.limits.MaxAlloc; max > 0 && p.buffered > max {
+		return nil, true, fmt.Errorf("%w: %v bytes in partial messages", ErrMessageTooLarge, p.buffered)
+	}
+	if !c.Last {
+		p.chunks[c.ID] = b
+		return nil, false, nil
+	}
+	delete(p.chunks, c.ID)
+	p.buffered -= len(b)
+	dt, err = p.decodeBytes(b)
+	if err != nil {
+		err = fmt.Errorf("chunked message: %w", err)
+	}
+	return dt, true, err
+}
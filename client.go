@@ -1,40 +1,153 @@
 package gna
 
 import (
-	"encoding/gob"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+/*DialOption configures how Dial connects to the server*/
+type DialOption func(*dialConfig)
+
+type dialConfig struct {
+	codec  Codec
+	tls    *tls.Config
+	ws     bool // addr is a ws:// or wss:// URL
+	udp    bool
+	resume bool
+
+	backoff   *Backoff // nil if the Client does not reconnect
+	handshake func(*Client) error
+	filter    func(interface{}) bool
+	hb        Heartbeat
+	creds     *Credentials
+}
+
+/*connect opens the connection to the address with the configured transport*/
+func (cfg *dialConfig) connect(addr string) (net.Conn, error) {
+	if cfg.ws {
+		return dialWebSocket(addr, cfg.tls)
+	}
+	if cfg.tls != nil {
+		return tls.Dial("tcp", addr, cfg.tls)
+	}
+	return net.Dial("tcp", addr)
+}
+
+/*WithCodec sets the codec used to talk with the server,
+it must match the codec of the server Instance. The default is Gob.*/
+func WithCodec(c Codec) DialOption {
+	return func(cfg *dialConfig) {
+		cfg.codec = c
+	}
+}
+
+/*WithTLS makes the Client connect through TLS with the configuration given,
+to use mutual TLS provide the client certificate in cfg.Certificates.*/
+func WithTLS(cfg *tls.Config) DialOption {
+	return func(c *dialConfig) {
+		c.tls = cfg
+	}
+}
+
+/*WithUDP makes the Client ask the server for an unreliable channel once
+started, used by DispatchUnreliable. If the server has none, the connection
+is used instead.*/
+func WithUDP() DialOption {
+	return func(c *dialConfig) {
+		c.udp = true
+	}
+}
+
+/*WithFilter sets the function that decides which messages from the server
+are accepted, the rejected ones are dropped as soon as they're decoded and
+never reach RecvBatch. Router.Accepts is a good filter.*/
+func WithFilter(f func(dt interface{}) bool) DialOption {
+	return func(c *dialConfig) {
+		c.filter = f
+	}
+}
+
+/*DialTLS is a shorthand for Dial(addr, WithTLS(cfg), opts...)*/
+func DialTLS(addr string, cfg *tls.Config, opts ...DialOption) (*Client, error) {
+	return Dial(addr, append([]DialOption{WithTLS(cfg)}, opts...)...)
+}
+
+/*DialWebSocket connects to a server through WebSocket, the url must use
+the ws or wss scheme and point to a Server.WebSocketHandler. For wss the
+config given by WithTLS is used, if any.*/
+func DialWebSocket(url string, opts ...DialOption) (*Client, error) {
+	return dial(url, dialConfig{codec: Gob, ws: true}, opts)
+}
+
 /*Dial tries to connect to the address. If any error is encountered it returns
 a nil *Client and a non-nil error.*/
-func Dial(addr string) (*Client, error) {
-	c, err := net.Dial("tcp", addr)
+func Dial(addr string, opts ...DialOption) (*Client, error) {
+	return dial(addr, dialConfig{codec: Gob}, opts)
+}
+
+func dial(addr string, cfg dialConfig, opts []DialOption) (*Client, error) {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	c, err := cfg.connect(addr)
 	if err != nil {
 		return nil, err
 	}
 	cli := &Client{
-		acu: &cliBucket{dt: make([]interface{}, 64)},
-		dispatcher: dispatcher{
-			conn:        c,
-			enc:         gob.NewEncoder(c),
-			dec:         gob.NewDecoder(c),
-			rTimeout:    stdReadTimeout,
-			wTimeout:    stdWriteTimeout,
-			cDisp:       make(chan interface{}),
-			shouldStart: true,
-		},
+		acu:    &cliBucket{dt: make([]interface{}, 64)},
+		cfg:    cfg,
+		addr:   addr,
+		events: make(chan ConnEvent, 16),
+		quit:   make(chan struct{}),
 	}
+	cli.init(c, cfg.codec, 64)
+	cli.q.overflow = OverflowBlock
+	cli.q.forever = true
+	cli.onClose = func() { cli.quitted.Do(func() { close(cli.quit) }) }
+	cli.filter = cfg.filter
+	cli.hb.cfg = cfg.hb
+	if cfg.resume {
+		err = cli.dispatcher.Send(resumeHello{})
+	}
+	if err == nil {
+		err = cli.login()
+	}
+	if err == nil {
+		err = cli.handshake()
+	}
+	if err != nil {
+		c.Close()
+		if cli.cause != nil {
+			err = cli.cause // refused by the server
+		}
+		return nil, err
+	}
+	cli.emit(Connected, nil)
 	return cli, nil
 }
 
 /*Client abstracts the connection handling and communication with the server.*/
 type Client struct {
 	acu     *cliBucket
+	cfg     dialConfig
+	addr    string
+	session resumeToken // guarded by mu, see WithResume
+	udp     atomic.Pointer[udpClient]
+	events  chan ConnEvent
+	calls   sync.Map // call ID to chan callResponse
+	callID  atomic.Uint64
+	cause   *DisconnectError // sent by the server, guarded by mu
+	ident   *Identity        // guarded by mu, see WithCredentials
 	err     error
 	started bool
+	quit    chan struct{} // closed by Close, ends the wait between reconnects
+	quitted sync.Once
+
+	handshaking atomic.Bool // Recv is allowed during the handshake
 	dispatcher
 }
 
@@ -47,11 +160,11 @@ func (c *Client) Send(dt interface{}) error {
 	return err
 }
 
-/*Dispatch is like send but it doesn't halt and doesn't guarantee delivery.
-If used with a unstarted Client it panics.*/
+/*Dispatch is like send but it doesn't guarantee delivery, it only halts
+while the queue is full. If used with a unstarted Client it panics.*/
 func (c *Client) Dispatch(data interface{}) {
 	if c.started {
-		c.cDisp <- data
+		c.q.put(Gameplay, data, c.closedChan())
 		return
 	}
 	panic("cannot dispatch, client not started")
@@ -60,14 +173,19 @@ func (c *Client) Dispatch(data interface{}) {
 /*Recv sets the deadline and encodes the data, if used after the Client
 has started it panics.*/
 func (c *Client) Recv() (interface{}, error) {
-	if c.started {
+	if c.started && !c.handshaking.Load() {
 		panic("recv cannot be used safely after Client has started")
 	}
-	out, err := c.dispatcher.Recv()
-	if out == nil {
-		return nil, err
+	for {
+		out, err := c.dispatcher.Recv()
+		if out == nil {
+			return nil, err
+		}
+		if err == nil && c.control(out) {
+			continue
+		}
+		return out, err
 	}
-	return out, err
 }
 
 /*RecvBatch empties the acumulator, retrieving the data*/
@@ -81,8 +199,12 @@ func (c *Client) RecvBatch() []interface{} {
 /*Start starts the client receiver and dispatcher*/
 func (c *Client) Start() {
 	c.started = true
+	c.running.Store(true)
 	go c.dispatcher.work()
 	go c.receiver()
+	if c.cfg.udp {
+		c.Dispatch(udpRequest{Want: true})
+	}
 }
 
 /*SetTimeout sets both read and write timeout*/
@@ -91,7 +213,15 @@ func (c *Client) SetTimeout(t time.Duration) {
 	c.wTimeout = t // racy c:
 }
 
+/*Error returns the error that closed the client, a *DisconnectError
+if the server told why*/
 func (c *Client) Error() error {
+	c.mu.Lock()
+	cause := c.cause
+	c.mu.Unlock()
+	if cause != nil {
+		return cause
+	}
 	if c.err != nil {
 		if c.dispatcher.err != nil {
 			return fmt.Errorf("%w, alongside: %v", c.err, c.dispatcher.err)
@@ -105,17 +235,20 @@ func (c *Client) Error() error {
 }
 
 func (c *Client) receiver() {
-	defer c.Close()
+	defer func() {
+		c.Close()
+		c.emit(Closed, c.Error())
+	}()
 	for {
 		dt, err := c.dispatcher.Recv()
 		if err != nil {
 			c.err = fmt.Errorf("recv: %w", err)
-			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
-				return
+			if c.reconnect() {
+				continue
 			}
 			return
 		}
-		if dt != nil { // ?
+		if dt != nil && !c.control(dt) && c.accepts(dt) {
 			c.acu.add(dt)
 		}
 	}
@@ -0,0 +1,299 @@
+package gna
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+/*Codec is the wire format of a connection. It creates the Encoder and Decoder
+that a Player or Client uses above the underlying stream, each Encode
+writes exactly one message and each Decode reads exactly one message.
+Codecs are used as map keys, so they must be comparable.
+*/
+type Codec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+/*Encoder writes one message at a time to the stream*/
+type Encoder interface {
+	Encode(dt interface{}) error
+}
+
+/*Decoder reads one message at a time from the stream*/
+type Decoder interface {
+	Decode() (interface{}, error)
+}
+
+/*Framer is implemented by codecs in which every message is self-contained,
+the bytes of an encoded message can be written as they are to any connection
+using the same codec. This is what allows a Group to encode a message once
+and ship it to every Player. All the codecs in this package are Framers.*/
+type Framer interface {
+	Frame(dt interface{}) ([]byte, error)
+}
+
+var (
+	/*Gob is the default codec, it's only meant to speak with Go peers.
+	Each message is a length-prefixed frame carrying its own type descriptors.*/
+	Gob Codec = gobCodec{}
+	/*JSON writes one JSON object per line in the form
+	{"type": <registered name>, "data": <value>}.*/
+	JSON Codec = jsonCodec{}
+	/*Binary writes length-prefixed frames, see binary.go for the layout.*/
+	Binary Codec = binaryCodec{}
+)
+
+/*Register is a convenience method that wraps
+gob.Register() underhood, it also makes the types
+known to the JSON and Binary codecs*/
+func Register(dt ...interface{}) {
+	for i := range dt {
+		gob.Register(dt[i])
+		types.add(reflect.TypeOf(dt[i]).String(), dt[i])
+	}
+}
+
+/*RegisterName is like Register, but uses the provided name
+for the type in every codec, this is what non-Go peers will see.*/
+func RegisterName(name string, dt interface{}) {
+	gob.RegisterName(name, dt)
+	types.add(name, dt)
+}
+
+/*registry maps the names used on the wire to concrete types and back,
+it's used by the codecs that are not self-describing like gob*/
+type registry struct {
+	names map[reflect.Type]string
+	types map[string]reflect.Type
+	mu    sync.RWMutex
+}
+
+var types = newRegistry()
+
+func newRegistry() *registry {
+	r := &registry{
+		names: make(map[reflect.Type]string, 32),
+		types: make(map[string]reflect.Type, 32),
+	}
+	basic := []interface{}{
+		"", false, []byte{},
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+	}
+	for _, dt := range basic {
+		r.add(reflect.TypeOf(dt).String(), dt)
+	}
+	return r
+}
+
+func (r *registry) add(name string, dt interface{}) {
+	t := reflect.TypeOf(dt)
+	r.mu.Lock()
+	r.names[t] = name
+	r.types[name] = t
+	r.mu.Unlock()
+}
+
+func (r *registry) name(dt interface{}) (string, error) {
+	t := reflect.TypeOf(dt)
+	r.mu.RLock()
+	name, ok := r.names[t]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("type not registered: %v", t)
+	}
+	return name, nil
+}
+
+func (r *registry) typeOf(name string) (reflect.Type, error) {
+	r.mu.RLock()
+	t, ok := r.types[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("type not registered: %q", name)
+	}
+	return t, nil
+}
+
+/*new returns a pointer to a zero value of the named type,
+and a function that retrieves the decoded value with the registered type*/
+func (r *registry) new(name string) (interface{}, func() interface{}, error) {
+	t, err := r.typeOf(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		return v.Interface(), v.Interface, nil
+	}
+	v := reflect.New(t)
+	return v.Interface(), v.Elem().Interface, nil
+}
+
+/*frameEncoder writes the frames created by a Framer*/
+type frameEncoder struct {
+	w io.Writer
+	f Framer
+}
+
+func (e frameEncoder) Encode(dt interface{}) error {
+	b, err := e.f.Frame(dt)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(b)
+	return err
+}
+
+/*readFrame reads a frame prefixed by its uint32 length,
+reusing buf if it's big enough, frames over the limits of the
+reader are refused before allocating them*/
+func readFrame(r io.Reader, buf []byte) ([]byte, error) {
+	var hdr [4]byte
+	_, err := io.ReadFull(r, hdr[:])
+	if err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[:])
+	if l := limitsOf(r); l != nil {
+		if err := l.checkSize(int(size)); err != nil {
+			return nil, err
+		}
+	}
+	if cap(buf) < int(size) {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	_, err = io.ReadFull(r, buf)
+	return buf, err
+}
+
+type gobCodec struct{}
+
+func (c gobCodec) NewEncoder(w io.Writer) Encoder {
+	return frameEncoder{w, c}
+}
+
+func (gobCodec) NewDecoder(r io.Reader) Decoder {
+	return &gobDecoder{r: r}
+}
+
+func (gobCodec) Frame(dt interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 4, 64))
+	err := gob.NewEncoder(buf).Encode(&dt)
+	if err != nil {
+		return nil, err
+	}
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	return b, nil
+}
+
+type gobDecoder struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (d *gobDecoder) Decode() (interface{}, error) {
+	var err error
+	d.buf, err = readFrame(d.r, d.buf)
+	if err != nil {
+		return nil, err
+	}
+	var dt interface{}
+	err = gob.NewDecoder(bytes.NewReader(d.buf)).Decode(&dt)
+	return dt, err
+}
+
+type jsonCodec struct{}
+
+func (c jsonCodec) NewEncoder(w io.Writer) Encoder {
+	return frameEncoder{w, c}
+}
+
+func (jsonCodec) NewDecoder(r io.Reader) Decoder {
+	return jsonDecoder{json.NewDecoder(r)}
+}
+
+type jsonEnvelope struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (c jsonCodec) Frame(dt interface{}) ([]byte, error) {
+	b, err := c.envelope(dt)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func (jsonCodec) envelope(dt interface{}) ([]byte, error) {
+	name, err := types.name(dt)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(dt)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonEnvelope{Type: name, Data: b})
+}
+
+type jsonDecoder struct {
+	dec *json.Decoder
+}
+
+func (d jsonDecoder) Decode() (interface{}, error) {
+	var env jsonEnvelope
+	err := d.dec.Decode(&env)
+	if err != nil {
+		return nil, err
+	}
+	return env.value()
+}
+
+/*value decodes the data with the type named in the envelope*/
+func (env jsonEnvelope) value() (interface{}, error) {
+	ptr, get, err := types.new(env.Type)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(env.Data, ptr)
+	if err != nil {
+		return nil, err
+	}
+	return get(), nil
+}
+
+/*anyValue holds a value of any registered type inside another message,
+in JSON it's written as an envelope so the type survives the trip*/
+type anyValue struct {
+	V interface{}
+}
+
+func (a anyValue) MarshalJSON() ([]byte, error) {
+	if a.V == nil {
+		return []byte("null"), nil
+	}
+	return jsonCodec{}.envelope(a.V)
+}
+
+func (a *anyValue) UnmarshalJSON(b []byte) error {
+	var env *jsonEnvelope
+	err := json.Unmarshal(b, &env)
+	if err != nil || env == nil {
+		a.V = nil
+		return err
+	}
+	a.V, err = env.value()
+	return err
+}
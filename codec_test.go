@@ -0,0 +1,145 @@
+package gna
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type codecPoint struct{ X, Y float64 }
+
+type codecMsg struct {
+	Name   string
+	P      *codecPoint
+	Path   []codecPoint
+	Scores map[string]int
+	At     time.Time
+	Raw    []byte
+}
+
+func init() {
+	Register(codecPoint{}, codecMsg{})
+}
+
+var codecs = []struct {
+	name  string
+	codec Codec
+}{
+	{"gob", Gob},
+	{"json", JSON},
+	{"binary", Binary},
+}
+
+var codecValues = []interface{}{
+	codecMsg{
+		Name:   "a",
+		P:      &codecPoint{1, 2},
+		Path:   []codecPoint{{3, 4}, {5, 6}},
+		Scores: map[string]int{"x": 1},
+		At:     time.Unix(5, 0).UTC(),
+		Raw:    []byte("hi"),
+	},
+	codecPoint{-1.5, 2.25},
+	"str",
+	42,
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, c := range codecs {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := c.codec.NewEncoder(&buf)
+			for _, v := range codecValues {
+				if err := enc.Encode(v); err != nil {
+					t.Fatalf("encode %T: %v", v, err)
+				}
+			}
+			dec := c.codec.NewDecoder(&buf)
+			for _, want := range codecValues {
+				got, err := dec.Decode()
+				if err != nil {
+					t.Fatalf("decode %T: %v", want, err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got %#v, want %#v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCodecFrame(t *testing.T) {
+	for _, c := range codecs {
+		t.Run(c.name, func(t *testing.T) {
+			// a frame is written as is, so it must decode like an encoded message
+			var buf bytes.Buffer
+			for _, v := range codecValues {
+				b, err := c.codec.(Framer).Frame(v)
+				if err != nil {
+					t.Fatalf("frame %T: %v", v, err)
+				}
+				buf.Write(b)
+			}
+			dec := c.codec.NewDecoder(&buf)
+			for _, want := range codecValues {
+				got, err := dec.Decode()
+				if err != nil {
+					t.Fatalf("decode %T: %v", want, err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got %#v, want %#v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCodecUnregistered(t *testing.T) {
+	type unknown struct{ A int }
+	for _, c := range codecs {
+		var buf bytes.Buffer
+		if err := c.codec.NewEncoder(&buf).Encode(unknown{1}); err == nil {
+			t.Errorf("%s: encoded an unregistered type", c.name)
+		}
+	}
+}
+
+/*emptyElems has elements that take no bytes in the Binary codec*/
+type emptyElems struct {
+	A []struct{}
+	B [][0]int
+	C []struct{ hidden int }
+	M map[struct{}]struct{}
+}
+
+func TestBinaryEmptyElements(t *testing.T) {
+	RegisterName("emptyElems", emptyElems{})
+	want := emptyElems{
+		A: make([]struct{}, 3),
+		B: make([][0]int, 2),
+		C: make([]struct{ hidden int }, 4),
+		M: map[struct{}]struct{}{{}: {}},
+	}
+	b, err := Binary.(Framer).Frame(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Binary.NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+
+	// a count that would allocate too much is still refused
+	huge := append([]byte(nil), b...)
+	at := bytes.Index(huge, []byte{0, 0, 0, 3})
+	copy(huge[at:], []byte{0x7F, 0xFF, 0xFF, 0xFF})
+	in := &limitReader{r: bytes.NewReader(huge), limits: Limits{}.withDefaults()}
+	if _, err := Binary.NewDecoder(in).Decode(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,136 @@
+package gna
+
+/*Control messages travel alongside the application data but never reach it,
+they're handled by the receivers of Player and Client. Their names are
+registered so non-Go peers can speak the protocol.*/
+
+func init() {
+	RegisterName("gna.udpRequest", udpRequest{})
+	RegisterName("gna.udpOffer", udpOffer{})
+	RegisterName("gna.resumeHello", resumeHello{})
+	RegisterName("gna.resumeToken", resumeToken{})
+	RegisterName("gna.resumeAck", resumeAck{})
+	RegisterName("gna.callRequest", callRequest{})
+	RegisterName("gna.callResponse", callResponse{})
+	RegisterName("gna.callCancel", callCancel{})
+	RegisterName("gna.ping", ping{})
+	RegisterName("gna.pong", pong{})
+	RegisterName("gna.chunk", chunk{})
+	RegisterName("gna.disconnect", disconnect{})
+	RegisterName("gna.login", login{})
+	RegisterName("gna.loginOK", loginOK{})
+}
+
+/*udpRequest is sent by the Client to ask for an unreliable channel*/
+type udpRequest struct {
+	Want bool
+}
+
+/*udpOffer is the answer to udpRequest, a Port of 0 means the
+server has no unreliable channel*/
+type udpOffer struct {
+	Port  int
+	ID    uint64
+	Token uint64
+}
+
+/*resumeHello is the first message of a Client using WithResume,
+the Token is empty for new sessions*/
+type resumeHello struct {
+	ID    uint64
+	Token string
+}
+
+/*resumeToken is sent to the Client once the Player is started,
+Grace is in milliseconds*/
+type resumeToken struct {
+	ID    uint64
+	Token string
+	Grace int64
+}
+
+/*resumeAck answers a resumeHello carrying a Token*/
+type resumeAck struct {
+	OK bool
+}
+
+/*callRequest is sent by Client.Call, Timeout is in milliseconds,
+zero means there's none*/
+type callRequest struct {
+	ID      uint64
+	Timeout int64
+	Data    anyValue
+}
+
+/*callResponse carries either the result or the error of the call*/
+type callResponse struct {
+	ID   uint64
+	Data anyValue
+	Err  *RemoteError
+}
+
+/*callCancel is sent when the caller gives up*/
+type callCancel struct {
+	ID uint64
+}
+
+/*login carries the Credentials of a Client dialed WithCredentials*/
+type login struct {
+	User   string
+	Secret string
+	Token  string
+}
+
+/*loginOK is sent once the credentials are accepted*/
+type loginOK struct {
+	UserID string
+	Roles  []string
+}
+
+/*control handles the control messages sent by the client,
+it returns false if the data is not a control message*/
+func (p *Player) control(dt interface{}) bool {
+	switch v := dt.(type) {
+	case udpRequest:
+		p.shipOn(Control, p.srv.offerUDP(p))
+	case callRequest:
+		p.call(v)
+	case callCancel:
+		p.cancelCall(v.ID)
+	case ping:
+		p.pong(v)
+	case pong:
+		p.observe(v)
+	case login:
+		// only expected before the Auth
+	default:
+		return false
+	}
+	return true
+}
+
+/*control handles the control messages sent by the server,
+it returns false if the data is not a control message*/
+func (c *Client) control(dt interface{}) bool {
+	switch v := dt.(type) {
+	case udpOffer:
+		if v.Port != 0 {
+			go c.startUDP(v)
+		}
+	case resumeToken:
+		c.mu.Lock()
+		c.session = v
+		c.mu.Unlock()
+	case callResponse:
+		c.response(v)
+	case disconnect:
+		c.disconnected(v)
+	case ping:
+		c.pong(v)
+	case pong:
+		c.observe(v)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package gna
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+/*DisconnectReason is the cause of a disconnection, it's an error itself
+so it can be used with errors.Is on Player.Error and on the errors of the
+Client: errors.Is(p.Error(), gna.DisconnectTimeout)*/
+type DisconnectReason int
+
+const (
+	DisconnectUnknown      DisconnectReason = iota
+	DisconnectTimeout                       // nothing was received in time, see Heartbeat
+	DisconnectClientClosed                  // the client closed the connection or it broke
+	DisconnectKicked                        // see Player.Kick
+	DisconnectOverflow                      // the send queue overflowed, see Overflow
+	DisconnectProtocol                      // the client sent something that could not be decoded
+	DisconnectShutdown                      // the server or the instance was terminated
+	DisconnectRateLimited                   // the client went over its RateLimit
+	DisconnectRejected                      // the connection was not admitted, see Admission
+)
+
+var reasonNames = [...]string{
+	DisconnectUnknown:      "unknown",
+	DisconnectTimeout:      "timeout",
+	DisconnectClientClosed: "client closed",
+	DisconnectKicked:       "kicked",
+	DisconnectOverflow:     "overflow",
+	DisconnectProtocol:     "protocol error",
+	DisconnectShutdown:     "server shutdown",
+	DisconnectRateLimited:  "rate limited",
+	DisconnectRejected:     "rejected",
+}
+
+func (r DisconnectReason) String() string {
+	if r < 0 || int(r) >= len(reasonNames) {
+		return fmt.Sprintf("DisconnectReason(%d)", int(r))
+	}
+	return reasonNames[r]
+}
+
+func (r DisconnectReason) Error() string {
+	return "gna: disconnected: " + r.String()
+}
+
+/*DisconnectError describes why a connection ended, it's returned by
+Player.Error and by Client.Error when the server sent the reason.*/
+type DisconnectError struct {
+	Reason  DisconnectReason
+	Message string // given to Kick, if any
+	Err     error  // underlying error, if any
+}
+
+func (e *DisconnectError) Error() string {
+	s := e.Reason.String()
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e *DisconnectError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Reason}
+	}
+	return []error{e.Reason, e.Err}
+}
+
+/*disconnect is the last message sent to a client that is being kicked or
+that is leaving because the server shuts down*/
+type disconnect struct {
+	Reason  DisconnectReason
+	Message string
+}
+
+/*setReason records the reason of the disconnection, only the first one counts*/
+func (p *dispatcher) setReason(r DisconnectReason) {
+	p.reason.CompareAndSwap(int32(DisconnectUnknown), int32(r))
+}
+
+/*Reason returns why the player was disconnected, or is being disconnected*/
+func (p *Player) Reason() DisconnectReason {
+	return DisconnectReason(p.reason.Load())
+}
+
+/*Kick disconnects the player, after sending what's already queued, the
+client gets the message as a DisconnectError and does not reconnect. It can
+be used inside Auth to tell the client why it was refused.*/
+func (p *Player) Kick(msg string) {
+	p.setReason(DisconnectKicked)
+	p.kickMsg = msg
+	d := disconnect{Reason: DisconnectKicked, Message: msg}
+	if !p.running.Load() {
+		p.dispatcher.Send(d)
+		p.Close()
+		return
+	}
+	p.flush(d)
+}
+
+/*recvReason tells the cause of a failed Recv*/
+func recvReason(err error) DisconnectReason {
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrMissedHeartbeats):
+		return DisconnectTimeout
+	case errors.Is(err, ErrRateLimited):
+		return DisconnectRateLimited
+	case errors.As(err, &ne) && ne.Timeout():
+		return DisconnectTimeout
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, net.ErrClosed):
+		return DisconnectClientClosed
+	}
+	var oe *net.OpError
+	if errors.As(err, &oe) {
+		return DisconnectClientClosed
+	}
+	return DisconnectProtocol
+}
+
+/*disconnected handles the last message of the server*/
+func (c *Client) disconnected(d disconnect) {
+	c.mu.Lock()
+	c.cause = &DisconnectError{Reason: d.Reason, Message: d.Message}
+	c.mu.Unlock()
+	if d.Reason == DisconnectKicked {
+		c.final.Store(true) // the server does not want it back
+	}
+}
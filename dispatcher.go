@@ -1,70 +1,209 @@
 package gna
 
 import (
-	"encoding/gob"
-	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type shipper interface {
 	/*sends the data to the right chan for dispatching*/
 	ship(interface{})
+	/*like ship, but on the channel given*/
+	shipOn(*Channel, interface{})
+	/*sends the data through the unreliable channel, if any*/
+	shipUnreliable(interface{})
 }
 
-/*dispatcher runs above a persistent TCP connection with gob encoding,
+/*frame is a message already encoded by a Framer,
+shared between every dispatcher using the same codec*/
+type frame struct {
+	b  []byte
+	dt interface{} // the message before encoding
+}
+
+/*frames caches the encoding of a single message for each codec*/
+type frames struct {
+	dt  interface{}
+	enc map[Codec]interface{}
+}
+
+/*get returns the frame of the data in the codec, or the data itself if
+the codec is not a Framer or fails to encode it, in which case the dispatcher
+will find the error on its own.*/
+func (fs *frames) get(c Codec) interface{} {
+	if out, ok := fs.enc[c]; ok {
+		return out
+	}
+	var out interface{} = fs.dt
+	if f, ok := c.(Framer); ok {
+		if b, err := f.Frame(fs.dt); err == nil {
+			out = &frame{b, fs.dt}
+		}
+	}
+	if fs.enc == nil {
+		fs.enc = make(map[Codec]interface{}, 1)
+	}
+	fs.enc[c] = out
+	return out
+}
+
+/*dispatcher runs above a persistent TCP connection with the chosen Codec,
 it acts as writer and owner of the connection.
 */
 type dispatcher struct {
-	conn net.Conn
-	enc  *gob.Encoder
-	dec  *gob.Decoder
-	err  error // encode/write error
+	conn  net.Conn
+	codec Codec
+	enc   Encoder
+	dec   Decoder
+	in    *limitReader // what the decoder reads from
+	err   error        // encode/write error
+
+	q        sendQueue
+	closed   chan struct{} // closed alongside the connection
+	stopped  chan struct{} // closed when the worker returns
+	flushing chan struct{} // asks the worker to send what's queued and close
+	running  atomic.Bool   // if the worker was started
+	final    atomic.Bool   // closed on purpose, the connection must not be resumed
+	onClose  func()        // called by Close, if set
+	unread   interface{}   // returned by the next Recv, if not nil
+	filter   func(interface{}) bool
+	hb       heartbeat
+	bulkID   atomic.Uint64
+	reason   atomic.Int32      // DisconnectReason
+	farewell interface{}       // written last by the worker when flushing
+	chunks   map[uint64][]byte // partial messages, only used by Recv
+	buffered int               // bytes in chunks
+	rl       rateLimiter       // of the messages received, see RateLimit
+	mu       sync.Mutex        // guards the swap of connections
 
-	cDisp chan interface{}
+	flushOnce sync.Once
 
 	rTimeout    time.Duration
 	wTimeout    time.Duration
-	shouldStart bool // only used after auth, not concurrently
+	limits      Limits      // of the messages received
+	shouldStart atomic.Bool // read after auth, Close may race with the receiver
+}
+
+func (p *dispatcher) init(c net.Conn, codec Codec, queue int) {
+	p.rTimeout = stdReadTimeout
+	p.wTimeout = stdWriteTimeout
+	p.q.init(queue, OverflowDisconnect, 0)
+	p.flushing = make(chan struct{})
+	p.shouldStart.Store(true)
+	p.codec = codec
+	p.hb.base = time.Now()
+	p.reset(c)
+}
+
+/*reset replaces the connection, keeping the queue and the codec,
+it must only be used while the worker and receiver are not running*/
+func (p *dispatcher) reset(c net.Conn) {
+	p.mu.Lock()
+	p.conn = c
+	p.closed = make(chan struct{})
+	p.stopped = make(chan struct{})
+	p.unread = nil
+	p.chunks, p.buffered = nil, 0 // the rest of them was lost with the connection
+	p.mu.Unlock()
+	p.SetCodec(p.codec)
+}
+
+/*closedChan returns the channel closed alongside the current connection*/
+func (p *dispatcher) closedChan() chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
 }
 
+/*ship queues the data on the Gameplay channel*/
 func (p *dispatcher) ship(dt interface{}) {
-	select {
-	case p.cDisp <- dt:
-	default:
+	p.shipOn(Gameplay, dt)
+}
+
+/*shipOn queues the data on the channel following the overflow policy of the queue*/
+func (p *dispatcher) shipOn(ch *Channel, dt interface{}) {
+	if !p.q.put(ch, p.split(ch, dt), p.closedChan()) {
 		/* this means
 		a: There is a faulty or intentionally bad receiver
 		b: The server resources are being overwelmed
 		in both cases closing the connection and clearing resources is needed.
 		*/
-		p.err = errors.New("full buffer")
+		p.err = ErrQueueFull
+		p.setReason(DisconnectOverflow)
 		p.Close()
 	}
 }
 
+/*accepts reports if the received data passes the filter, if any*/
+func (p *dispatcher) accepts(dt interface{}) bool {
+	return p.filter == nil || p.filter(dt)
+}
+
+/*tryShip queues the data on the channel only if there's room for it*/
+func (p *dispatcher) tryShip(ch *Channel, dt interface{}) {
+	p.q.tryPut(ch, dt)
+}
+
 /*Send sets the deadline and encodes the data, it may halt, but it returns the error
 in case of failure, guaranteeing knowledge if the user has the data.
 This differs from pConn.ship() in which it's only known after the connection is closed.*/
 func (p *dispatcher) Send(dt interface{}) error {
-	err := p.conn.SetWriteDeadline(time.Now().Add(15 * time.Second))
+	err := p.conn.SetWriteDeadline(time.Now().Add(p.wTimeout))
 	if err != nil {
 		return err
 	}
-	return p.enc.Encode(&dt)
+	if f, ok := dt.(*frame); ok {
+		_, err = p.conn.Write(f.b)
+		return err
+	}
+	return p.enc.Encode(dt)
 }
 
 /*Recv sets the deadline and decodes data from the connection,
-you cannot use this safely after the receiver is started*/
+you cannot use this safely after the receiver is started. With heartbeats
+enabled the deadline is the heartbeat window instead of the read timeout.*/
 func (p *dispatcher) Recv() (interface{}, error) {
-	err := p.conn.SetReadDeadline(time.Now().Add(p.rTimeout))
-	if err != nil {
-		err = fmt.Errorf("failed to set deadline: %w", err)
-		return nil, err
+	if p.unread != nil {
+		dt := p.unread
+		p.unread = nil
+		return dt, nil
+	}
+	timeout := p.rTimeout
+	if p.hb.cfg.Interval > 0 {
+		timeout = p.hb.cfg.window()
+	}
+	for {
+		err := p.conn.SetReadDeadline(time.Now().Add(timeout))
+		if err != nil {
+			err = fmt.Errorf("failed to set deadline: %w", err)
+			return nil, err
+		}
+		p.in.reset()
+		dt, err := p.dec.Decode()
+		c, ok := dt.(chunk)
+		if err != nil || !ok {
+			return dt, err
+		}
+		dt, done, err := p.assemble(c)
+		if done || err != nil {
+			return dt, err
+		}
+		if err := p.throttleChunk(p.in.n); err != nil {
+			return nil, err
+		}
 	}
-	var dt interface{}
-	err = p.dec.Decode(&dt)
-	return dt, err
+}
+
+/*SetCodec replaces the codec used above the connection, both peers must agree
+on it. It's only safe to use before the receiver is started, eg: inside Auth.*/
+func (p *dispatcher) SetCodec(c Codec) {
+	p.codec = c
+	p.enc = c.NewEncoder(p.conn)
+	p.in = &limitReader{r: p.conn, limits: p.limits}
+	p.dec = c.NewDecoder(p.in)
 }
 
 /*Error returns the error that caused the pConn to disconnect.*/
@@ -74,20 +213,101 @@ func (p *dispatcher) Error() error {
 
 /*Close terminates the player, closing the connection.*/
 func (p *dispatcher) Close() error {
-	p.shouldStart = false // used in auth
-	return p.conn.Close()
+	p.shouldStart.Store(false) // used in auth
+	p.final.Store(true)
+	err := p.closeConn()
+	if p.onClose != nil {
+		p.onClose()
+	}
+	return err
 }
 
+/*closeConn closes the current connection, which may be replaced later
+if the dispatcher was not closed on purpose*/
+func (p *dispatcher) closeConn() error {
+	p.mu.Lock()
+	select {
+	case <-p.closed:
+	default:
+		close(p.closed)
+	}
+	c := p.conn
+	p.mu.Unlock()
+	return c.Close()
+}
+
+/*flush asks the worker to send everything that is queued, followed by last
+if not nil, and then close the connection. If the worker is not running the
+connection is closed at once.*/
+func (p *dispatcher) flush(last interface{}) {
+	if !p.running.Load() {
+		p.Close()
+		return
+	}
+	p.final.Store(true)
+	p.flushOnce.Do(func() {
+		p.farewell = last
+		close(p.flushing)
+	})
+	if p.onClose != nil {
+		p.onClose()
+	}
+}
+
+/*work writes the queue to the connection until it's closed, what is left
+in the queue stays there in case the connection is replaced*/
 func (p *dispatcher) work() {
-	defer p.Close()
+	p.mu.Lock()
+	closed, stopped := p.closed, p.stopped
+	p.mu.Unlock()
+	defer close(stopped)
+	defer p.closeConn()
+	if p.hb.cfg.Interval > 0 {
+		go p.beat(closed)
+	}
 	for {
-		dt := <-p.cDisp
-		err := p.Send(dt)
-		if err != nil {
-			if p.err == nil {
-				p.err = err
+		select {
+		case <-p.q.ready:
+			if !p.drain() {
+				return
+			}
+		case <-p.flushing:
+			if p.drain() && p.farewell != nil {
+				p.write(p.farewell)
 			}
 			return
+		case <-closed:
+			return
+		}
+	}
+}
+
+/*drain writes what's in the queue, it returns false if a write fails*/
+func (p *dispatcher) drain() bool {
+	for {
+		dt, ok := p.q.take()
+		if !ok {
+			return true
+		}
+		if b, ok := dt.(*bulk); ok {
+			dt = b.next()
+			if len(b.b) > 0 {
+				p.q.pushFront(b.ch, b)
+			}
+		}
+		if !p.write(dt) {
+			return false
+		}
+	}
+}
+
+func (p *dispatcher) write(dt interface{}) bool {
+	err := p.Send(dt)
+	if err != nil {
+		if p.err == nil {
+			p.err = err
 		}
+		return false
 	}
+	return true
 }
@@ -39,11 +39,7 @@ func main() {
 }
 
 func Connect(addr, pwd string) (*gna.Client, *shared.Blob) {
-	client, err := gna.Dial(addr)
-	if err != nil {
-		panic(err)
-	}
-	err = client.Send(pwd)
+	client, err := gna.Dial(addr, gna.WithCredentials(gna.Credentials{Secret: pwd}))
 	if err != nil {
 		panic(err)
 	}
@@ -61,11 +61,7 @@ func getImage(file string) (EImg *ebiten.Image, diameter float64) {
 }
 
 func Connect(addr, pwd string) (*gna.Client, *shared.Blob) {
-	client, err := gna.Dial(addr)
-	if err != nil {
-		log.Fatal(err)
-	}
-	err = client.Send(pwd)
+	client, err := gna.Dial(addr, gna.WithCredentials(gna.Credentials{Secret: pwd}))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"errors"
 	"flag"
 	"github.com/kazhmir/gna"
 	"github.com/kazhmir/gna/examples/blobs/shared"
@@ -12,7 +11,10 @@ import (
 	"time"
 )
 
-var cpuprofile = flag.String("ppcpu", "", "write cpu profile to `file`")
+var (
+	cpuprofile = flag.String("ppcpu", "", "write cpu profile to `file`")
+	pwd        = flag.String("pwd", "password", "Host Password")
+)
 
 func main() {
 	flag.Parse()
@@ -34,7 +36,8 @@ func main() {
 	gna.SetReadTimeout(60 * time.Second)
 	gna.SetWriteTimeout(15 * time.Second)
 	gna.SetMaxTPS(20)
-	if err := gna.RunServer("0.0.0.0:8888", server); err != nil {
+	auth := gna.WithAuthenticator(gna.SharedSecret{Secret: *pwd})
+	if err := gna.RunServer("0.0.0.0:8888", server, auth); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -82,27 +85,16 @@ func (sr *Server) Disconn(p *gna.Player) {
 	log.Printf("%v Disconnected. Reason: %v\n", p.ID, p.Error())
 }
 
+/*Auth is only called for the players that knew the password*/
 func (sr *Server) Auth(p *gna.Player) {
-	a, err := p.Recv()
-	if err != nil {
-		log.Println(err)
-		p.Close()
-	}
-	if pwd, ok := a.(string); ok {
-		if pwd == "password" {
-			b := sr.NewBlob(p.ID)
-			p.Send(b)
-			sr.mu.Lock()
-			for _, b := range sr.blobs {
-				p.Send(b)
-			}
-			sr.mu.Unlock()
-			sr.Dispatch(sr.Players, shared.Event{ID: p.ID, T: shared.EBorn})
-			return
-		}
+	b := sr.NewBlob(p.ID)
+	p.Send(b)
+	sr.mu.Lock()
+	for _, b := range sr.blobs {
+		p.Send(b)
 	}
-	p.Send(errors.New("invalid password"))
-	p.Close()
+	sr.mu.Unlock()
+	sr.Dispatch(sr.Players, shared.Event{ID: p.ID, T: shared.EBorn})
 }
 
 func (gm *Server) NewBlob(id uint64) *shared.Blob {
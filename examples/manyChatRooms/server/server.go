@@ -6,59 +6,70 @@ import (
 	"github.com/kazhmir/gna/examples/manyChatRooms/shared"
 	"log"
 	"strconv"
-	"sync"
 	"time"
 )
 
-var rooms []*Room
+var rooms = gna.NewInstanceManager(nil)
 
 func Start(addr string) error {
-	gna.SetReadTimeout(60 * time.Second)
-	gna.SetWriteTimeout(60 * time.Second)
-	main := createMany(10)
-	return gna.RunServer(addr, main)
+	timeouts := gna.WithTimeouts(60*time.Second, 60*time.Second)
+	main, err := createMany(10, timeouts)
+	if err != nil {
+		return err
+	}
+	return gna.RunServer(addr, main, timeouts)
 }
 
-func createMany(num int) (main *Room) {
-	rooms = make([]*Room, num)
+func createMany(num int, opts ...gna.InstanceOption) (main *Room, err error) {
 	for i := 0; i < num; i++ {
-		rooms[i] = createInst()
+		ins, err := rooms.Create(strconv.Itoa(i), createInst, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			main = ins.(*Room)
+		}
 	}
-	return rooms[0] // main
+	return main, nil
 }
 
-func createInst() *Room {
-	sr := &Room{Users: make(map[uint64]string, 64)}
-	go gna.RunInstance(sr)
+func createInst() gna.Instance {
+	sr := &Room{router: gna.NewRouter[*gna.Player]()}
+	gna.Handle(sr.router, sr.onMessage)
+	gna.Handle(sr.router, sr.onCmd)
+	sr.SetFilter(sr.router.Accepts)
 	return sr
 }
 
+/*username travels with the player between rooms*/
+var username = gna.NewKey[string]("username")
+
+func name(p *gna.Player) string {
+	n, _ := username.Get(p)
+	return n
+}
+
 type Room struct {
-	Users map[uint64]string
-	mu    sync.Mutex
+	router *gna.Router[*gna.Player]
 	gna.Net
 }
 
 func (r *Room) Update() {
-	dt := r.GetData()
-	for _, input := range dt {
-		switch v := input.Data.(type) {
-		case string:
-			r.mu.Lock()
-			r.Dispatch(r.Players, shared.Message{Username: r.Users[input.P.ID], Data: v})
-			r.mu.Unlock()
-		case shared.Cmd:
-			s, all := r.ExecCmd(&v, input.P)
-			msg := shared.Message{Username: "server", Data: s}
-			if all {
-				r.mu.Lock()
-				r.Dispatch(r.Players, msg)
-				r.mu.Unlock()
-				continue
-			}
-			r.Dispatch(input.P, msg)
-		}
+	gna.RouteInputs(r.router, r.GetData())
+}
+
+func (r *Room) onMessage(p *gna.Player, v string) {
+	r.Dispatch(r.Players, shared.Message{Username: name(p), Data: v})
+}
+
+func (r *Room) onCmd(p *gna.Player, v shared.Cmd) {
+	s, all := r.ExecCmd(&v, p)
+	msg := shared.Message{Username: "server", Data: s}
+	if all {
+		r.Dispatch(r.Players, msg)
+		return
 	}
+	r.Dispatch(p, msg)
 }
 
 func (r *Room) Auth(p *gna.Player) {
@@ -69,15 +80,11 @@ func (r *Room) Auth(p *gna.Player) {
 		return
 	}
 	if v, ok := dt.(shared.CliAuth); ok {
-		r.mu.Lock()
-		r.Users[p.ID] = v.Name
+		username.Set(p, v.Name)
 		fmt.Printf("%v (ID: %v) Connected.\n", v.Name, p.ID)
 		r.Dispatch(r.Players, shared.Message{Username: "server", Data: v.Name + " Connected."})
-		r.mu.Unlock()
 	}
-	r.mu.Lock()
 	err = p.Send(shared.SrAuth{UserID: p.ID})
-	r.mu.Unlock()
 	if err != nil {
 		log.Println(err)
 		p.Close()
@@ -85,43 +92,36 @@ func (r *Room) Auth(p *gna.Player) {
 }
 
 func (r *Room) Disconn(p *gna.Player) {
-	fmt.Printf("%v (ID: %v) Disconnected. Reason: %v\n", r.Users[p.ID], p.ID, p.Error())
-	r.Dispatch(r.Players, shared.Message{Username: "server", Data: r.Users[p.ID] + " Disconnected."})
-	r.mu.Lock()
-	delete(r.Users, p.ID)
-	r.mu.Unlock()
+	fmt.Printf("%v (ID: %v) Disconnected. Reason: %v\n", name(p), p.ID, p.Error())
+	r.Dispatch(r.Players, shared.Message{Username: "server", Data: name(p) + " Disconnected."})
+}
+
+func (r *Room) OnEnter(p *gna.Player, from gna.Instance) {
+	if from == nil {
+		return // announced in Auth
+	}
+	r.Dispatch(r.Players, shared.Message{Username: "server", Data: name(p) + " joined the room."})
+}
+
+func (r *Room) OnLeave(p *gna.Player, to gna.Instance) {
+	r.Dispatch(r.Players, shared.Message{Username: "server", Data: name(p) + " left the room."})
 }
 
 func (r *Room) ExecCmd(cmd *shared.Cmd, p *gna.Player) (msg string, toAll bool) {
 	switch cmd.T {
 	case shared.CName:
-		r.mu.Lock()
-		old := r.Users[p.ID]
-		r.Users[p.ID] = cmd.Data
-		r.mu.Unlock()
+		old := name(p)
+		username.Set(p, cmd.Data)
 		return fmt.Sprintf("%v changed name to %v", old, cmd.Data), true
 	case shared.CRoom:
-		n, err := strconv.Atoi(cmd.Data)
-		if err != nil {
-			return fmt.Sprintf("could not change room: %v", err), false
-		}
-		if n > len(rooms) || n < 0 {
-			return fmt.Sprintf("could not change room: there is no room %v", n), false
+		ins, ok := rooms.Get(cmd.Data)
+		if !ok {
+			return fmt.Sprintf("could not change room: there is no room %v", cmd.Data), false
 		}
-		r.mu.Lock()
-		name := r.Users[p.ID]
-		delete(r.Users, p.ID)
-		r.mu.Unlock()
-		p.SetInstance(rooms[n])
-		rooms[n].mu.Lock()
-		rooms[n].Users[p.ID] = name
-		rooms[n].mu.Unlock()
-		return fmt.Sprintf("%v changed to room %v", name, n), true
+		p.SetInstance(ins) // OnLeave and OnEnter announce it
+		return fmt.Sprintf("changed to room %v", cmd.Data), false
 	case shared.Num:
-		r.mu.Lock()
-		n := len(r.Users)
-		r.mu.Unlock()
-		return fmt.Sprintf("People in room: %v", n), false
+		return fmt.Sprintf("People in room: %v", r.Players.Len()), false
 	}
 	return "invalid command", false
 }
@@ -44,12 +44,52 @@ func (g *Group) Rm(id uint64) {
 	g.mu.Unlock()
 }
 
-/*ship sends the sig channel and data to each Talker in the group*/
-//TODO: This method makes each Player.ear do duplicated work, it should be optimized to encode only once
+/*ship encodes the data once for each codec in use by the players
+and sends the resulting frame to each of them*/
 func (g *Group) ship(data interface{}) {
+	g.shipOn(Gameplay, data)
+}
+
+/*shipOn is like ship, but on the channel given*/
+func (g *Group) shipOn(ch *Channel, data interface{}) {
+	fs := frames{dt: data}
+	// shipping can block under OverflowBlock, so not under the lock
+	for _, p := range g.list() {
+		p.shipOn(ch, fs.get(p.codec))
+	}
+}
+
+/*shipUnreliable is like ship, but through the unreliable channel of each player*/
+func (g *Group) shipUnreliable(data interface{}) {
+	fs := frames{dt: data}
+	for _, p := range g.list() {
+		p.shipUnreliable(fs.get(p.codec))
+	}
+}
+
+/*list returns a snapshot of the players in the group*/
+func (g *Group) list() []*Player {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make([]*Player, 0, len(g.pMap))
+	for _, p := range g.pMap {
+		out = append(out, p)
+	}
+	return out
+}
+
+/*get returns the player with the id, or nil*/
+func (g *Group) get(id uint64) *Player {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.pMap[id]
+}
+
+/*each calls f for every player in the group, f must not use the group*/
+func (g *Group) each(f func(*Player)) {
 	g.mu.Lock()
 	for _, p := range g.pMap {
-		p.ship(data)
+		f(p)
 	}
 	g.mu.Unlock()
 }
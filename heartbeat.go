@@ -0,0 +1,135 @@
+package gna
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+/*ErrMissedHeartbeats is the error of connections closed because
+the peer stopped answering the heartbeats*/
+var ErrMissedHeartbeats = errors.New("gna: missed heartbeats")
+
+/*Heartbeat configures the pings sent below the application, while
+enabled a connection is only considered dead after MaxMissed pings
+in a row go unanswered, no matter how long the application stays silent.
+A zero Interval disables them.*/
+type Heartbeat struct {
+	Interval  time.Duration
+	MaxMissed int // 3 if zero
+}
+
+/*window is how long the connection may go without receiving anything*/
+func (hb Heartbeat) window() time.Duration {
+	return hb.Interval * time.Duration(hb.maxMissed()+1)
+}
+
+func (hb Heartbeat) maxMissed() int {
+	if hb.MaxMissed <= 0 {
+		return 3
+	}
+	return hb.MaxMissed
+}
+
+/*heartbeat keeps the state of the pings of a dispatcher, the RTT and
+jitter are smoothed as in TCP (RFC 6298)*/
+type heartbeat struct {
+	cfg    Heartbeat
+	base   time.Time // timestamps are relative to it, so they're monotonic
+	missed atomic.Int32
+	rtt    atomic.Int64
+	jitter atomic.Int64
+}
+
+/*ping is sent every interval, the peer answers it with a pong
+carrying the same timestamp*/
+type ping struct {
+	Sent int64
+}
+
+type pong struct {
+	Sent int64
+}
+
+/*SetHeartbeat enables heartbeats for the players accepted after the call,
+the players answer the pings of their clients regardless of it.*/
+func (s *Server) SetHeartbeat(hb Heartbeat) {
+	s.mu.Lock()
+	s.hb = hb
+	s.mu.Unlock()
+}
+
+func (s *Server) heartbeat() Heartbeat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hb
+}
+
+/*WithHeartbeat makes the Client ping the server, see Heartbeat.
+The client answers the pings of the server regardless of it.*/
+func WithHeartbeat(hb Heartbeat) DialOption {
+	return func(c *dialConfig) {
+		c.hb = hb
+	}
+}
+
+/*RTT returns the smoothed round trip time of the connection, it's
+zero until the first heartbeat is answered*/
+func (p *dispatcher) RTT() time.Duration {
+	return time.Duration(p.hb.rtt.Load())
+}
+
+/*Jitter returns the smoothed variation of the RTT*/
+func (p *dispatcher) Jitter() time.Duration {
+	return time.Duration(p.hb.jitter.Load())
+}
+
+/*beat pings the peer every interval until the connection is closed,
+closing it if too many pings go unanswered*/
+func (p *dispatcher) beat(closed chan struct{}) {
+	t := time.NewTicker(p.hb.cfg.Interval)
+	defer t.Stop()
+	p.hb.missed.Store(0)
+	for {
+		select {
+		case <-t.C:
+		case <-closed:
+			return
+		}
+		if int(p.hb.missed.Add(1)) > p.hb.cfg.maxMissed() {
+			if p.err == nil {
+				p.err = ErrMissedHeartbeats
+			}
+			p.setReason(DisconnectTimeout)
+			p.closeConn()
+			return
+		}
+		p.tryShip(Control, ping{Sent: int64(time.Since(p.hb.base))})
+	}
+}
+
+/*pong answers a ping of the peer*/
+func (p *dispatcher) pong(v ping) {
+	p.tryShip(Control, pong(v))
+}
+
+/*observe takes a RTT sample from the answer of a ping*/
+func (p *dispatcher) observe(v pong) {
+	p.hb.missed.Store(0)
+	sample := int64(time.Since(p.hb.base)) - v.Sent
+	if sample < 0 {
+		return
+	}
+	rtt := p.hb.rtt.Load()
+	if rtt == 0 {
+		p.hb.rtt.Store(sample)
+		p.hb.jitter.Store(sample / 2)
+		return
+	}
+	diff := rtt - sample
+	if diff < 0 {
+		diff = -diff
+	}
+	p.hb.jitter.Store((3*p.hb.jitter.Load() + diff) / 4)
+	p.hb.rtt.Store((7*rtt + sample) / 8)
+}
@@ -0,0 +1,70 @@
+package gna
+
+import "sync"
+
+/*The hooks are optional interfaces an Instance may implement, Net calls them
+on the instance goroutine, in order with Update and Disconn, so they can
+touch the game state without locks.*/
+
+/*EnterHook is called when a player is set to the instance, from is the
+instance the player left or nil if it just connected. The Disconn of the
+player, if any, is called after it.*/
+type EnterHook interface {
+	OnEnter(p *Player, from Instance)
+}
+
+/*LeaveHook is called when a player is moved to another instance,
+players that disconnect go through Disconn instead*/
+type LeaveHook interface {
+	OnLeave(p *Player, to Instance)
+}
+
+/*StartHook is called once, before the first Update*/
+type StartHook interface {
+	OnStart()
+}
+
+/*StopHook is called once after Terminate, when the last Update,
+every pending Disconn and every CallHandler have returned*/
+type StopHook interface {
+	OnStop()
+}
+
+/*eventQueue keeps the hooks to be run before the next Update, it has its
+own lock so players can be moved between instances without lock ordering*/
+type eventQueue struct {
+	q  []func()
+	mu sync.Mutex
+}
+
+func (e *eventQueue) post(f func()) {
+	e.mu.Lock()
+	e.q = append(e.q, f)
+	e.mu.Unlock()
+}
+
+/*run calls the hooks queued so far, in order*/
+func (e *eventQueue) run() {
+	e.mu.Lock()
+	q := e.q
+	e.q = nil
+	e.mu.Unlock()
+	for _, f := range q {
+		f()
+	}
+}
+
+/*moved queues the hooks of the instances involved in the move of the player*/
+func moved(p *Player, from, to Instance) {
+	if h, ok := from.(LeaveHook); ok {
+		from.NetAbs().events.post(func() { h.OnLeave(p, to) })
+	}
+	select {
+	case <-p.gone:
+		return // set to the instance after its Disconn
+	default:
+	}
+	if h, ok := to.(EnterHook); ok {
+		to.NetAbs().events.post(func() { h.OnEnter(p, from) })
+	}
+}
@@ -0,0 +1,65 @@
+package gna
+
+import "testing"
+
+/*orderIns logs its calls without locks, the race detector
+complains if any two of them run at the same time*/
+type orderIns struct {
+	Net
+	log     []string
+	updates int
+}
+
+func (ins *orderIns) Auth(p *Player)                   {}
+func (ins *orderIns) Update()                          { ins.updates++ }
+func (ins *orderIns) OnStart()                         { ins.log = append(ins.log, "start") }
+func (ins *orderIns) OnStop()                          { ins.log = append(ins.log, "stop") }
+func (ins *orderIns) OnEnter(p *Player, from Instance) { ins.log = append(ins.log, "enter") }
+func (ins *orderIns) OnLeave(p *Player, to Instance)   { ins.log = append(ins.log, "leave") }
+func (ins *orderIns) Disconn(p *Player) {
+	ins.log = append(ins.log, "disconn")
+	ins.updates++
+}
+
+func TestHooksOrder(t *testing.T) {
+	a, b := &orderIns{}, &orderIns{}
+	for _, ins := range []Instance{a, b} {
+		startInstance(ins, []InstanceOption{WithTPS(100)})
+		go runLoop(ins)
+	}
+	p := pipePlayer(t, 1)
+	p.SetInstance(a)
+	p.SetInstance(b)
+	// disconnected before b runs its hooks
+	b.dc <- p
+	<-p.gone
+	a.Terminate()
+	b.Terminate()
+	a.wait()
+	b.wait()
+	want := map[*orderIns][]string{
+		a: {"start", "enter", "leave", "stop"},
+		b: {"start", "enter", "disconn", "stop"},
+	}
+	for ins, log := range want {
+		if len(ins.log) != len(log) {
+			t.Fatalf("got %v, want %v", ins.log, log)
+		}
+		for i := range log {
+			if ins.log[i] != log[i] {
+				t.Fatalf("got %v, want %v", ins.log, log)
+			}
+		}
+	}
+}
+
+func TestHooksEnterAfterDisconn(t *testing.T) {
+	ins := &orderIns{}
+	p := pipePlayer(t, 1)
+	close(p.gone) // Disconn returned
+	moved(p, nil, ins)
+	ins.events.run()
+	if len(ins.log) != 0 {
+		t.Fatal(ins.log)
+	}
+}
@@ -1,6 +1,9 @@
 package gna
 
-/*Instance is your game state. Each method runs concurrently with one another.
+import "time"
+
+/*Instance is your game state. Update and Disconn run on the instance goroutine,
+Auth runs concurrently with them.
 You're meant to provide Auth, Disconn and Update only and let NetAbs and Terminate
 be used from the embedded Net struct
 */
@@ -8,7 +11,8 @@ type Instance interface {
 	/*Update loop of your game state, you can get the batch of data from the Players
 	with Instance.GetData(), and dispatch it with Instance.Dispatch*/
 	Update()
-	/*Disconn happens when a player disconnects*/
+	/*Disconn happens when a player disconnects, it's called on the instance
+	goroutine before the next Update, like the hooks (see EnterHook)*/
 	Disconn(*Player)
 	/*Auth happens when a player connects, to refuse the player connection
 	simply close it: Player.Close(). To accept it, leave it be. The instance is
@@ -23,35 +27,120 @@ type Instance interface {
 	Terminate()
 }
 
-/*RunInstance starts the ticker and Disconnection Handler,
+/*InstanceOption configures an Instance when it's run, the ones not given
+take the package defaults (see SetMaxTPS, SetReadTimeout and SetWriteTimeout)*/
+type InstanceOption func(*Net)
+
+/*WithTPS sets the tickrate of the instance, it can be changed
+later with Net.SetTPS*/
+func WithTPS(tps int) InstanceOption {
+	return func(n *Net) {
+		if tps > 0 {
+			n.tps = tps
+		}
+	}
+}
+
+/*WithTimeouts sets the read and write timeouts of the players
+set to the instance*/
+func WithTimeouts(read, write time.Duration) InstanceOption {
+	return func(n *Net) {
+		n.rTimeout = read
+		n.wTimeout = write
+	}
+}
+
+/*WithQueueSize sets the size of the send queue of the players accepted
+by the listener of the instance, players moved here from other instances
+keep their own queue.*/
+func WithQueueSize(size int) InstanceOption {
+	return func(n *Net) {
+		n.queue = size
+	}
+}
+
+/*WithTickPolicy is like Net.SetTickPolicy*/
+func WithTickPolicy(p TickPolicy, maxCatchUp int) InstanceOption {
+	return func(n *Net) {
+		n.sched.policy = p
+		n.sched.maxCatch = maxCatchUp
+	}
+}
+
+/*RunInstance starts the tick loop and Disconnection Handler,
 it's the only place where Instance.Update is called.
 If RunInstance is called twice in a Instance it just returns.
+It returns after Terminate, once every pending Disconn was called.
 */
-func RunInstance(ins Instance) {
+func RunInstance(ins Instance, opts ...InstanceOption) {
+	if startInstance(ins, opts) {
+		runLoop(ins)
+	}
+}
+
+/*startInstance prepares the Net so players can be set to the instance,
+it returns false if the instance was already started, in which case
+the options are ignored*/
+func startInstance(ins Instance, opts []InstanceOption) bool {
 	n := ins.NetAbs()
 	n.mu.Lock()
+	defer n.mu.Unlock()
 	if n.started {
-		return
+		return false
 	}
 	n.fillDefault()
+	for _, opt := range opts {
+		opt(n)
+	}
 	n.started = true
-	n.mu.Unlock()
-	go dcHandler(n.dc, ins)
+	return true
+}
+
+func runLoop(ins Instance) {
+	n := ins.NetAbs()
+	dcDone := make(chan struct{})
+	go func() {
+		dcHandler(ins)
+		close(dcDone)
+	}()
+	if h, ok := ins.(StartHook); ok {
+		h.OnStart()
+	}
+	n.tickLoop(ins)
+	<-dcDone
+	n.events.run()
+	n.callers.Wait()
+	if h, ok := ins.(StopHook); ok {
+		h.OnStop()
+	}
+	close(n.stopped)
+}
+
+/*dcHandler queues the Disconn of each disconnected player, so it's called
+on the instance goroutine before the next Update, after Terminate it queues
+the ones already waiting and returns*/
+func dcHandler(ins Instance) {
+	n := ins.NetAbs()
 	for {
 		select {
-		case <-n.ticker.C:
-			ins.Update()
+		case p := <-n.dc:
+			n.events.post(func() { n.disconn(ins, p) })
 		case <-n.done:
-			return
+			for {
+				select {
+				case p := <-n.dc:
+					n.events.post(func() { n.disconn(ins, p) })
+				default:
+					return
+				}
+			}
 		}
 	}
 }
 
-func dcHandler(dc chan *Player, ins Instance) {
-	n := ins.NetAbs()
-	for {
-		p := <-dc
-		n.Players.Rm(p.ID)
-		ins.Disconn(p)
-	}
+func (n *Net) disconn(ins Instance, p *Player) {
+	n.Players.Rm(p.ID)
+	ins.Disconn(p)
+	p.meta.clear()
+	close(p.gone)
 }
@@ -0,0 +1,138 @@
+package gna
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+var (
+	/*ErrMessageTooLarge is the error of a message that goes over the Limits*/
+	ErrMessageTooLarge = errors.New("gna: message too large")
+	/*ErrTypeNotAllowed is the error of a message whose type is not
+	in the allow-list of the instance, see WithAllowedTypes*/
+	ErrTypeNotAllowed = errors.New("gna: type not allowed")
+)
+
+const stdMaxMessage = 1 << 20 // bytes
+
+/*Limits bound what a single message received from a client can cost,
+going over them closes the Player with DisconnectProtocol.
+MaxMessage is the size of a message on the wire, 1 MiB if zero. MaxAlloc
+is how much decoding a message may allocate, four times MaxMessage if zero,
+it's enforced by the Binary codec while for Gob and JSON allocations are
+already bounded by the size of the message. MaxAlloc also bounds the bytes
+kept for the chunked messages that are still incomplete.*/
+type Limits struct {
+	MaxMessage int
+	MaxAlloc   int
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxMessage <= 0 {
+		l.MaxMessage = stdMaxMessage
+	}
+	if l.MaxAlloc <= 0 {
+		l.MaxAlloc = 4 * l.MaxMessage
+	}
+	return l
+}
+
+/*WithLimits sets the limits of the messages received from the players
+accepted by the listener of the instance, including the ones read in Auth.
+Players moved here from other instances keep their own limits.*/
+func WithLimits(l Limits) InstanceOption {
+	return func(n *Net) {
+		n.limits = l.withDefaults()
+	}
+}
+
+/*WithAllowedTypes makes the players in the instance only accept messages
+of the types given, besides the control messages of gna, the requests of
+calls (see HandleCalls) must be of the types given as well. A player sending
+anything else is closed with DisconnectProtocol. Unlike SetFilter, it's
+meant for clients that misbehave, not for routing.*/
+func WithAllowedTypes(dt ...interface{}) InstanceOption {
+	return func(n *Net) {
+		n.allowed = make(map[reflect.Type]bool, len(dt))
+		for i := range dt {
+			n.allowed[reflect.TypeOf(dt[i])] = true
+		}
+	}
+}
+
+func (n *Net) getLimits() Limits {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.limits
+}
+
+/*allows reports if the message passes the allow-list of the instance,
+if any. Control messages do, but the payload of a call must be allowed.*/
+func (p *Player) allows(dt interface{}) bool {
+	switch v := dt.(type) {
+	case callRequest:
+		return v.Data.V == nil || p.allowsType(v.Data.V)
+	case udpRequest, callCancel, ping, pong, login:
+		return true
+	}
+	return p.allowsType(dt)
+}
+
+/*allowsType reports if the data is in the allow-list of the instance, if any*/
+func (p *Player) allowsType(dt interface{}) bool {
+	return p.allowed == nil || p.allowed[reflect.TypeOf(dt)]
+}
+
+/*limitReader is the reader given to the decoders, it counts the bytes
+read by each Decode and lets the codecs know the limits of the connection.
+A zero limit means there's none.*/
+type limitReader struct {
+	r      io.Reader
+	limits Limits
+	n      int // read since the last reset
+}
+
+func (l *limitReader) Read(b []byte) (int, error) {
+	// a decoder only reads again while the message is incomplete,
+	// so everything read by this Decode belongs to it
+	if max := l.limits.MaxMessage; max > 0 && l.n > max {
+		return 0, ErrMessageTooLarge
+	}
+	n, err := l.r.Read(b)
+	l.n += n
+	return n, err
+}
+
+func (l *limitReader) reset() {
+	l.n = 0
+}
+
+/*checkSize fails if a message of the size goes over the limit*/
+func (l *limitReader) checkSize(size int) error {
+	if l.limits.MaxMessage > 0 && size > l.limits.MaxMessage {
+		return fmt.Errorf("%w: %v bytes", ErrMessageTooLarge, size)
+	}
+	return nil
+}
+
+/*limitsOf returns the limits of the reader given to a decoder*/
+func limitsOf(r io.Reader) *limitReader {
+	l, _ := r.(*limitReader)
+	return l
+}
+
+/*decodeBytes decodes a message that was not read from the connection,
+like a reassembled one, within the limits of the connection*/
+func (p *dispatcher) decodeBytes(b []byte) (interface{}, error) {
+	in := &limitReader{r: bytes.NewReader(b), limits: p.limits}
+	return p.codec.NewDecoder(in).Decode()
+}
+
+/*setLimits changes the limits of the messages received*/
+func (p *dispatcher) setLimits(l Limits) {
+	p.limits = l
+	p.in.limits = l
+}
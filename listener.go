@@ -1,9 +1,9 @@
 package gna
 
 import (
-	"encoding/gob"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net"
 	"os"
 	"os/signal"
@@ -17,99 +17,124 @@ var (
 	stdTPS          = 20 // ticks per second
 )
 
+const stdQueue = 32 // send queue of each player
+
 /*SetReadTimeout sets the default read timeout for
-every player*/
+every player, see WithTimeouts to set it per instance*/
 func SetReadTimeout(d time.Duration) {
 	stdReadTimeout = d
 }
 
 /*SetWriteTimeout sets the default write timeout for
-every player*/
+every player, see WithTimeouts to set it per instance*/
 func SetWriteTimeout(d time.Duration) {
 	stdWriteTimeout = d
 }
 
-/*SetMaxTPS sets the default tickrate of instances*/
+/*SetMaxTPS sets the default tickrate of instances, see WithTPS
+to set it per instance*/
 func SetMaxTPS(tps int) {
 	stdTPS = tps
 }
 
-/*Register is a convenience method that wraps
-gob.Register() underhood*/
-func Register(dt ...interface{}) {
-	for i := range dt {
-		gob.Register(dt[i])
+/*RunServer starts the listener and the instance, it blocks until
+the process receives an interrupt signal. To embed the server in a bigger
+program use NewServer instead.*/
+func RunServer(addr string, ins Instance, opts ...InstanceOption) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	s := NewServer()
+	err := s.Listen(addr, ins, opts...)
+	if err != nil {
+		return err
 	}
-}
-
-/*RunServer starts the listener and the instance*/
-func RunServer(addr string, ins Instance) error {
-	l := listener{
-		mainIns: ins,
+	fmt.Println("listening on: ", addr)
+	err = s.Serve(ctx)
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Stopping server...")
+		return nil
 	}
-	return l.start(addr)
+	return err
 }
 
+/*listener accepts connections and hands them to the main instance*/
 type listener struct {
 	mainIns Instance
-	idGen   id
+	srv     *Server
+	ln      net.Listener // nil when used as a http.Handler
+	codec   Codec        // if nil, the codec of the main instance
+	opts    []InstanceOption
 }
 
-/*start setups the server and starts it, it starts the listener and instance in
-different goroutines*/
-func (sr *listener) start(addr string) error {
-	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
-	listener, err := net.ListenTCP("tcp", tcpAddr)
-	if err != nil {
-		return err
+/*accept is responsible for the auth of each Player*/
+func (l *listener) accept(conn net.Conn) {
+	codec := l.codec
+	if codec == nil {
+		codec = l.mainIns.NetAbs().getCodec()
 	}
-	defer listener.Close()
-	chConns := make(chan *net.TCPConn)
-
-	go connRecv(listener, chConns)
-	go RunInstance(sr.mainIns)
-
-	fmt.Println("listening on: ", addr)
-	return sr.listen(chConns)
-}
-
-/*listen is responsible for the auth of each Player and
-to safely terminate the mainInstance*/
-func (sr *listener) listen(conns chan *net.TCPConn) error {
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
-	for {
-		select {
-		case conn := <-conns:
-			p := newPlayer(sr.idGen.newID(), conn)
-			go func() {
-				sr.mainIns.Auth(p)
-				if p.shouldStart {
-					if p.grp == nil {
-						p.SetInstance(sr.mainIns)
-					}
-					p.start()
-				}
-			}()
-		case <-sig:
-			fmt.Println("Stopping server...")
-			sr.mainIns.Terminate()
-			return nil
-		}
+	conn, reason := l.srv.screen(conn)
+	p := newPlayer(l.srv.idGen.newID(), conn, codec, l.mainIns.NetAbs().queueSize())
+	p.srv = l.srv
+	if reason != "" {
+		l.srv.reject(p, reason)
+		return
 	}
+	p.hb.cfg = l.srv.heartbeat()
+	p.setLimits(l.mainIns.NetAbs().getLimits())
+	p.SetOverflow(l.mainIns.NetAbs().overflowPolicy())
+	if !l.srv.admit(p) {
+		l.srv.authDone()
+		return
+	}
+	go func() {
+		defer l.srv.conns.Done()
+		defer l.srv.authDone()
+		expired := authTimer(p, l.srv.admission().AuthTimeout)
+		defer expired()
+		if err := p.handshake(); err != nil {
+			p.err = fmt.Errorf("tls handshake: %w", err)
+			p.Close()
+			l.srv.players.Rm(p.ID)
+			return
+		}
+		if l.srv.resumeGrace() > 0 && l.srv.tryResume(p, expired) {
+			return
+		}
+		if a := l.mainIns.NetAbs().authenticator(); a != nil && !p.authenticate(a) {
+			l.srv.players.Rm(p.ID)
+			return
+		}
+		l.mainIns.Auth(p)
+		if expired() && p.grp == nil {
+			p.Close() // if it's in an instance already, it must go through Disconn
+		}
+		if p.shouldStart.Load() {
+			if p.grp == nil {
+				p.SetInstance(l.mainIns)
+			}
+			l.srv.start(p)
+			return
+		}
+		l.srv.players.Rm(p.ID)
+	}()
 }
 
-func connRecv(l *net.TCPListener, out chan *net.TCPConn) {
+/*connRecv accepts connections until the listener is closed,
+it only returns an error if the listener fails on its own*/
+func (l *listener) connRecv() error {
 	for {
-		conn, err := l.AcceptTCP()
+		conn, err := l.ln.Accept()
 		if err != nil {
-			log.Print(err) //TODO remove logging
-			if _, ok := err.(*net.OpError); ok {
-				return
+			if l.srv.isClosing() {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
 			}
-			continue
+			return err
 		}
-		out <- conn
+		l.accept(conn)
 	}
 }
 
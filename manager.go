@@ -0,0 +1,116 @@
+package gna
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	/*ErrInstanceExists is returned by InstanceManager.Create if the name is taken*/
+	ErrInstanceExists = errors.New("gna: instance already exists")
+	/*ErrNoInstance is returned by InstanceManager.Destroy if there's no instance with the name*/
+	ErrNoInstance = errors.New("gna: no such instance")
+)
+
+/*InstanceManager keeps the instances created at runtime by name,
+like a match instance per game. It's safe for concurrent use.*/
+type InstanceManager struct {
+	srv  *Server
+	inss map[string]Instance
+	mu   sync.Mutex
+}
+
+/*NewInstanceManager creates an empty manager, if srv is not nil the instances
+created are terminated alongside it on Shutdown.*/
+func NewInstanceManager(srv *Server) *InstanceManager {
+	return &InstanceManager{
+		srv:  srv,
+		inss: make(map[string]Instance, 8),
+	}
+}
+
+/*Create runs the instance returned by factory under the name, the options
+are the same as RunInstance. Players can be set to it as soon as it returns.*/
+func (m *InstanceManager) Create(name string, factory func() Instance, opts ...InstanceOption) (Instance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.inss[name]; ok {
+		return nil, ErrInstanceExists
+	}
+	ins := factory()
+	if startInstance(ins, opts) {
+		go runLoop(ins)
+	}
+	m.inss[name] = ins
+	if m.srv != nil {
+		m.srv.track(ins)
+	}
+	return ins, nil
+}
+
+/*Get returns the instance with the name*/
+func (m *InstanceManager) Get(name string) (Instance, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ins, ok := m.inss[name]
+	return ins, ok
+}
+
+/*List returns the names of the instances, sorted*/
+func (m *InstanceManager) List() []string {
+	m.mu.Lock()
+	out := make([]string, 0, len(m.inss))
+	for name := range m.inss {
+		out = append(out, name)
+	}
+	m.mu.Unlock()
+	sort.Strings(out)
+	return out
+}
+
+/*Destroy moves the players left in the instance to another one, or
+disconnects them if to is nil, then terminates the instance and waits for
+its last Update and Disconn. It must not be called from the instance itself.
+Players set to the instance after it was destroyed, by a SetInstance racing
+with Destroy, are closed.*/
+func (m *InstanceManager) Destroy(name string, to Instance) error {
+	m.mu.Lock()
+	ins, ok := m.inss[name]
+	delete(m.inss, name)
+	m.mu.Unlock()
+	if !ok {
+		return ErrNoInstance
+	}
+	n := ins.NetAbs()
+	var ps []*Player
+	n.mu.Lock()
+	g := n.Players
+	n.mu.Unlock()
+	g.each(func(p *Player) {
+		ps = append(ps, p)
+	})
+	if to != nil {
+		for _, p := range ps {
+			p.SetInstance(to)
+		}
+	} else {
+		// like Server.Shutdown, the players go through Disconn
+		// before the instance is terminated
+		for _, p := range ps {
+			p.setReason(DisconnectShutdown)
+			p.flush(disconnect{Reason: DisconnectShutdown})
+		}
+		for _, p := range ps {
+			if p.running.Load() {
+				<-p.gone
+			}
+		}
+	}
+	ins.Terminate()
+	n.wait()
+	if m.srv != nil {
+		m.srv.untrack(ins)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package gna
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+/*testIns echoes what it gets to every player and counts the Disconns*/
+type testIns struct {
+	Net
+	disc atomic.Int32
+}
+
+func (ins *testIns) Auth(p *Player)    {}
+func (ins *testIns) Disconn(p *Player) { ins.disc.Add(1) }
+func (ins *testIns) Update() {
+	for _, in := range ins.GetData() {
+		ins.Dispatch(ins.Players, in.Data)
+	}
+}
+
+/*pipePlayer returns a player, not started, above one end of a pipe*/
+func pipePlayer(t *testing.T, id uint64) *Player {
+	c, s := net.Pipe()
+	t.Cleanup(func() {
+		c.Close()
+		s.Close()
+	})
+	return newPlayer(id, s, Gob, stdQueue)
+}
+
+func TestManager(t *testing.T) {
+	m := NewInstanceManager(nil)
+	a, err := m.Create("a", func() Instance { return &testIns{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Create("a", func() Instance { return &testIns{} }); err != ErrInstanceExists {
+		t.Fatal(err)
+	}
+	m.Create("b", func() Instance { return &testIns{} })
+	if names := m.List(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatal(names)
+	}
+	if got, ok := m.Get("a"); !ok || got != a {
+		t.Fatal(got, ok)
+	}
+	b, _ := m.Get("b")
+	p := pipePlayer(t, 1)
+	p.SetInstance(a)
+	if err := m.Destroy("a", b); err != nil {
+		t.Fatal(err)
+	}
+	if p.ins != b || b.NetAbs().Players.Len() != 1 {
+		t.Fatal("player not moved")
+	}
+	if err := m.Destroy("a", nil); err != ErrNoInstance {
+		t.Fatal(err)
+	}
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("destroyed instance still listed")
+	}
+}
+
+func TestManagerSetDestroyed(t *testing.T) {
+	m := NewInstanceManager(nil)
+	ins, _ := m.Create("room", func() Instance { return &testIns{} })
+	if err := m.Destroy("room", nil); err != nil {
+		t.Fatal(err)
+	}
+	// like a player joining the room as it's destroyed
+	p := pipePlayer(t, 1)
+	p.SetInstance(ins)
+	if !p.final.Load() || p.Reason() != DisconnectShutdown {
+		t.Fatal("player not closed")
+	}
+	if p.ins != nil {
+		t.Fatal("player set to a destroyed instance")
+	}
+}
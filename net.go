@@ -1,6 +1,7 @@
 package gna
 
 import (
+	"reflect"
 	"sync"
 	"time"
 )
@@ -11,15 +12,31 @@ server Instance, providing the Terminate and NetAbs methods.
 type Net struct {
 	rTimeout time.Duration
 	wTimeout time.Duration
-	done     chan struct{}
-	ticker   *time.Ticker
+	done     chan struct{} // closed by Terminate
+	stopped  chan struct{} // closed when the update loop returns
+	tps      int
+	queue    int // send queue of the players accepted by the listener
+	sched    scheduler
+	events   eventQueue // hooks waiting for the next Update
 
 	Players *Group
 
+	overflow     Overflow // see WithOverflow
+	overflowWait time.Duration
+	limits       Limits
+	allowed      map[reflect.Type]bool // nil allows every type
+	rate         RateLimit
+
 	acu *playerBucket
 	dc  chan *Player
 
+	codec   Codec
+	filter  func(interface{}) bool
+	calls   CallHandler
+	callers sync.WaitGroup // CallHandlers running, waited before OnStop
+	authn   Authenticator  // see WithAuthenticator
 	started bool
+	once    sync.Once
 	mu      sync.Mutex
 }
 
@@ -30,20 +47,99 @@ func (n *Net) NetAbs() *Net {
 	return n
 }
 
+/*SetCodec sets the codec of the players accepted by the listener
+of this Instance, it must be called before the server starts. Players
+moved here from other instances keep their own codec.*/
+func (n *Net) SetCodec(c Codec) {
+	n.mu.Lock()
+	n.codec = c
+	n.mu.Unlock()
+}
+
+/*SetFilter sets the function that decides which messages the players
+in this instance may send, the rejected ones are dropped as soon as
+they're decoded and never reach GetData. Router.Accepts is a good filter.*/
+func (n *Net) SetFilter(f func(dt interface{}) bool) {
+	n.mu.Lock()
+	n.filter = f
+	n.mu.Unlock()
+}
+
+/*SetTPS changes the tickrate of the instance, it takes effect
+from the next tick on*/
+func (n *Net) SetTPS(tps int) {
+	if tps <= 0 {
+		return
+	}
+	n.mu.Lock()
+	n.tps = tps
+	n.mu.Unlock()
+}
+
+/*queueSize returns the size of the send queue for new players*/
+func (n *Net) queueSize() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.queue <= 0 {
+		return stdQueue
+	}
+	return n.queue
+}
+
+func (n *Net) getCodec() Codec {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.codec == nil {
+		return Gob
+	}
+	return n.codec
+}
+
+/*lifecycle creates the channels that signal termination, they may be
+needed before the instance runs*/
+func (n *Net) lifecycle() {
+	n.once.Do(func() {
+		n.done = make(chan struct{})
+		n.stopped = make(chan struct{})
+	})
+}
+
+/*wait blocks until the update loop of the instance returns*/
+func (n *Net) wait() {
+	n.lifecycle()
+	<-n.stopped
+}
+
 func (n *Net) fillDefault() {
+	n.lifecycle()
 	n.rTimeout = stdReadTimeout
 	n.wTimeout = stdWriteTimeout
-	n.done = make(chan struct{})
-	n.ticker = time.NewTicker(time.Second / time.Duration(stdTPS))
+	n.tps = stdTPS
+	n.queue = stdQueue
+	n.limits = Limits{}.withDefaults()
 	n.Players = &Group{pMap: make(map[uint64]*Player, 16)}
 	n.acu = &playerBucket{dt: make([]*Input, 64)}
 	n.dc = make(chan *Player, 1)
 }
 
-/*Terminate closes the connection with all players and stops the updates*/
+/*Terminate closes the connection with all players and stops the updates,
+calling it more than once has no effect*/
 func (n *Net) Terminate() {
-	n.Players.Close()
-	n.done <- struct{}{}
+	n.lifecycle()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	select {
+	case <-n.done:
+		return
+	default:
+	}
+	if n.Players != nil {
+		n.Players.each(func(p *Player) {
+			p.setReason(DisconnectShutdown)
+		})
+		n.Players.Close()
+	}
+	close(n.done)
 }
 
 /*GetData empties the Net acumulator, retrieving the Inputs*/
@@ -56,3 +152,11 @@ the structs that implement ship() are: Players and Groups*/
 func (*Net) Dispatch(s shipper, data interface{}) {
 	s.ship(data)
 }
+
+/*DispatchUnreliable sends the data through the UDP channel of the players
+that have one (see Server.ListenUDP), the others get it through their
+connection only if there's room in their queue. Use it for data that is
+better dropped than late, like positions.*/
+func (*Net) DispatchUnreliable(s shipper, data interface{}) {
+	s.shipUnreliable(data)
+}
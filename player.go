@@ -1,47 +1,71 @@
 package gna
 
 import (
-	"encoding/gob"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
+	"reflect"
 	"sync"
-	//"sync"
+	"sync/atomic"
+	"time"
 )
 
-func newPlayer(id uint64, c net.Conn) *Player {
-	return &Player{
-		ID: id,
-		dispatcher: dispatcher{
-			conn:        c,
-			rTimeout:    stdReadTimeout,
-			wTimeout:    stdWriteTimeout,
-			enc:         gob.NewEncoder(c),
-			dec:         gob.NewDecoder(c),
-			cDisp:       make(chan interface{}, 32),
-			shouldStart: true,
-		},
-	}
+func newPlayer(id uint64, c net.Conn, codec Codec, queue int) *Player {
+	p := &Player{ID: id, gone: make(chan struct{})}
+	p.init(c, codec, queue)
+	p.onClose = p.wake
+	return p
 }
 
 /*Player represents the player connection,
 it has a receiver and dispatcher that run concurrently above
 a persistent TCP connection*/
 type Player struct {
-	ID  uint64
-	dc  chan *Player  // chan to the disconnection handler
-	acu *playerBucket // player acumulator, shared with other players in the instance
-	grp *Group        // instance group
-	err error         // decode/read error
+	ID   uint64
+	dc   chan *Player    // chan to the disconnection handler
+	done <-chan struct{} // closed when the instance terminates
+	acu  *playerBucket   // player acumulator, shared with other players in the instance
+	grp  *Group          // instance group
+	ins  Instance        // current instance
+	srv  *Server
+	udp  atomic.Pointer[udpSession] // nil if there's no unreliable channel
+	err  error                      // decode/read error
+
+	ident   *Identity             // see Authenticator
+	kickMsg string                // see Kick
+	allowed map[reflect.Type]bool // see WithAllowedTypes
+
+	calls CallHandler
+	cs    callState
+	meta  metaStore // see Key
+
+	token     string        // resume token, empty if resumption is disabled
+	suspended bool          // guarded by mu, waiting for the client to resume
+	timer     *time.Timer   // ends the suspension
+	parked    chan struct{} // closed when the player gets suspended
+	gone      chan struct{} // closed once Disconn returns
 	dispatcher
 }
 
+/*start runs the receiver and dispatcher, both are accounted
+in the server so it can wait for them on shutdown*/
 func (p *Player) start() {
+	p.mu.Lock()
+	p.parked = make(chan struct{})
+	p.mu.Unlock()
+	p.running.Store(true)
 	go p.receiver()
-	go p.work()
+	go func() {
+		defer p.srv.conns.Done()
+		p.work()
+	}()
 }
 
 /*SetInstance removes the player from the previous instance, if any,
-and sends him to another.*/
+and sends him to another. See EnterHook and LeaveHook. If the instance was
+terminated, or destroyed by an InstanceManager, the player is closed instead
+and goes through the Disconn of the instance it's in.*/
 func (p *Player) SetInstance(ins Instance) {
 	n := ins.NetAbs()
 	n.mu.Lock()
@@ -49,6 +73,13 @@ func (p *Player) SetInstance(ins Instance) {
 	if !n.started {
 		panic("instance not started") // probably a little too harsh
 	}
+	select {
+	case <-n.done:
+		p.setReason(DisconnectShutdown)
+		p.Close()
+		return
+	default:
+	}
 	if p.grp != nil {
 		p.grp.Rm(p.ID)
 	}
@@ -58,41 +89,136 @@ func (p *Player) SetInstance(ins Instance) {
 	p.rTimeout = n.rTimeout
 	p.wTimeout = n.wTimeout
 	p.dc = n.dc
+	p.done = n.done
+	p.filter = n.filter
+	p.calls = n.calls
+	p.allowed = n.allowed
+	p.rl.configure(n.rate)
+	from := p.ins
+	p.ins = ins
+	moved(p, from, ins)
+	if p.srv != nil {
+		p.srv.track(ins)
+	}
+}
+
+/*handshake completes the TLS handshake, if the player is using TLS,
+so the peer certificates are available inside Auth*/
+func (p *Player) handshake() error {
+	c, ok := p.tlsConn()
+	if !ok {
+		return nil
+	}
+	err := c.SetDeadline(time.Now().Add(p.rTimeout))
+	if err != nil {
+		return err
+	}
+	return c.Handshake()
+}
+
+/*ConnectionState returns the state of the TLS connection,
+ok is false if the player did not connect through TLS*/
+func (p *Player) ConnectionState() (state tls.ConnectionState, ok bool) {
+	c, ok := p.tlsConn()
+	if !ok {
+		return state, false
+	}
+	return c.ConnectionState(), true
+}
+
+/*tlsConn returns the TLS connection of the player, if it's using TLS,
+either directly or below a WebSocket served by a TLS http.Server*/
+func (p *Player) tlsConn() (*tls.Conn, bool) {
+	c := p.conn
+	for {
+		switch w := c.(type) {
+		case *countedConn:
+			c = w.Conn
+		case *wsConn:
+			c = w.Conn
+		default:
+			t, ok := c.(*tls.Conn)
+			return t, ok
+		}
+	}
+}
+
+/*PeerCertificate returns the certificate presented by the player,
+or nil if it presented none or did not connect through TLS*/
+func (p *Player) PeerCertificate() *x509.Certificate {
+	state, ok := p.ConnectionState()
+	if !ok || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
 }
 
 func (p *Player) disc() {
-	p.dc <- p
+	p.cancelCalls()
+	p.cs.running.Wait()
+	p.srv.players.Rm(p.ID)
+	p.srv.dropUDP(p)
+	select {
+	case p.dc <- p:
+	case <-p.done:
+	}
 }
 
 func (p *Player) receiver() {
-	defer p.disc()
-	defer p.Close()
+	defer p.srv.conns.Done()
 	for {
 		dt, err := p.Recv()
 		if err != nil {
 			p.err = fmt.Errorf("recv: %w", err)
-			/*if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
-				return
-			}*/
-			return
+			p.setReason(recvReason(err))
+			break
 		}
-		if dt != nil { // ?
+		if dt == nil {
+			continue
+		}
+		ok, err := p.throttle(p.in.n) // the chunks before it were charged by Recv
+		if err != nil {
+			p.err = fmt.Errorf("recv: %w: %T", err, dt)
+			p.setReason(DisconnectRateLimited)
+			break
+		}
+		if !ok {
+			continue
+		}
+		if !p.allows(dt) {
+			p.err = fmt.Errorf("recv: %w: %T", ErrTypeNotAllowed, dt)
+			p.setReason(DisconnectProtocol)
+			break
+		}
+		if !p.control(dt) && p.accepts(dt) {
 			p.acu.add(&Input{p, dt})
 		}
 	}
+	p.closeConn()
+	p.mu.Lock()
+	stopped := p.stopped
+	p.mu.Unlock()
+	<-stopped
+	if !p.suspend() {
+		p.Close()
+		p.disc()
+	}
 }
 
+/*Error returns why the player was disconnected as a *DisconnectError,
+or nil if it's still connected*/
 func (p *Player) Error() error {
-	if p.err != nil {
-		if p.dispatcher.err != nil {
-			return fmt.Errorf("%w, alongside: %v", p.err, p.dispatcher.err)
-		}
-		return p.err
+	err := p.err
+	if err != nil && p.dispatcher.err != nil {
+		err = fmt.Errorf("%w, alongside: %v", err, p.dispatcher.err)
+	} else if err == nil {
+		err = p.dispatcher.err
 	}
-	if p.dispatcher.err != nil {
-		return p.dispatcher.err
+	r := p.Reason()
+	if err == nil && r == DisconnectUnknown {
+		return nil
 	}
-	return nil
+	return &DisconnectError{Reason: r, Message: p.kickMsg, Err: err}
 }
 
 type playerBucket struct {
@@ -0,0 +1,271 @@
+package gna
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*ErrQueueFull is the error of players disconnected because their send queue
+overflowed while using OverflowDisconnect or OverflowBlock*/
+var ErrQueueFull = errors.New("gna: full buffer")
+
+/*Overflow is what happens when data is shipped to a Player whose send
+queue is full, which means the client is too slow or not reading at all.
+Each Channel has a lane of its own in the queue, of the size of the queue.*/
+type Overflow int
+
+const (
+	/*OverflowDisconnect closes the connection, this is the default*/
+	OverflowDisconnect Overflow = iota
+	/*OverflowDropOldest drops the oldest message in the queue to make room*/
+	OverflowDropOldest
+	/*OverflowDropNewest drops the message being shipped*/
+	OverflowDropNewest
+	/*OverflowReplace replaces the queued message with the same QueueKey as
+	the one being shipped, if there's none it drops the oldest. Good for
+	snapshots, where only the newest one matters.*/
+	OverflowReplace
+	/*OverflowBlock waits for room up to the duration given, blocking the
+	caller, and then closes the connection. Zero waits a second.*/
+	OverflowBlock
+)
+
+const stdBlockWait = time.Second // of OverflowBlock when no wait is given
+
+/*Keyed is implemented by messages that can replace each other in the send
+queue under OverflowReplace*/
+type Keyed interface {
+	QueueKey() string
+}
+
+/*WithOverflow sets the overflow policy of the send queue of the players
+accepted by the listener of the instance, wait is only used by OverflowBlock.
+Players moved here from other instances keep their own policy.*/
+func WithOverflow(o Overflow, wait time.Duration) InstanceOption {
+	return func(n *Net) {
+		n.overflow = o
+		n.overflowWait = wait
+	}
+}
+
+func (n *Net) overflowPolicy() (Overflow, time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.overflow, n.overflowWait
+}
+
+/*SetOverflow changes the overflow policy of the send queue of the player,
+wait is only used by OverflowBlock.*/
+func (p *Player) SetOverflow(o Overflow, wait time.Duration) {
+	p.q.mu.Lock()
+	p.q.overflow = o
+	p.q.wait = wait
+	p.q.mu.Unlock()
+}
+
+/*Dropped returns how many messages were dropped or replaced
+because the send queue was full*/
+func (p *dispatcher) Dropped() uint64 {
+	return p.q.dropped.Load()
+}
+
+/*sendQueue is the queue between the ship methods and the worker, it keeps
+a bounded FIFO lane for each Channel in use, with a policy for when a lane
+is full. The worker always takes from the lane with the highest priority.*/
+type sendQueue struct {
+	lanes    []*lane // sorted by priority, highest first
+	size     int     // of each lane
+	overflow Overflow
+	wait     time.Duration
+	forever  bool          // OverflowBlock waits until stopped, for the Client
+	ready    chan struct{} // signaled when items are added
+	space    chan struct{} // signaled when items are taken
+	dropped  atomic.Uint64
+	mu       sync.Mutex
+}
+
+type lane struct {
+	ch      *Channel
+	items   []interface{}
+	partial bool // items[0] is a message partly written, it must not be dropped
+}
+
+func (q *sendQueue) init(size int, o Overflow, wait time.Duration) {
+	if size <= 0 {
+		size = 1
+	}
+	q.size = size
+	q.overflow = o
+	q.wait = wait
+	q.ready = make(chan struct{}, 1)
+	q.space = make(chan struct{}, 1)
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+/*lane returns the lane of the channel, creating it if needed,
+it must be called with the lock held*/
+func (q *sendQueue) lane(ch *Channel) *lane {
+	for _, l := range q.lanes {
+		if l.ch == ch {
+			return l
+		}
+	}
+	l := &lane{ch: ch, items: make([]interface{}, 0, q.size)}
+	i := sort.Search(len(q.lanes), func(i int) bool {
+		return q.lanes[i].ch.Priority < ch.Priority
+	})
+	q.lanes = append(q.lanes, nil)
+	copy(q.lanes[i+1:], q.lanes[i:])
+	q.lanes[i] = l
+	return l
+}
+
+/*put queues the data in the lane of the channel following the overflow
+policy, stop ends the wait of OverflowBlock. It returns false if the
+connection must be closed.*/
+func (q *sendQueue) put(ch *Channel, dt interface{}, stop <-chan struct{}) bool {
+	var timeout <-chan time.Time
+	for {
+		q.mu.Lock()
+		l := q.lane(ch)
+		if len(l.items) < q.size {
+			l.items = append(l.items, dt)
+			q.mu.Unlock()
+			notify(q.ready)
+			return true
+		}
+		switch q.overflow {
+		case OverflowDropOldest:
+			l.dropOldest(dt)
+			q.dropped.Add(1)
+		case OverflowDropNewest:
+			q.dropped.Add(1)
+		case OverflowReplace:
+			if !l.replace(dt) {
+				l.dropOldest(dt)
+			}
+			q.dropped.Add(1)
+		case OverflowBlock:
+			wait, forever := q.wait, q.forever
+			q.mu.Unlock()
+			if wait <= 0 {
+				wait = stdBlockWait
+			}
+			if timeout == nil && !forever {
+				timeout = time.After(wait)
+			}
+			select {
+			case <-q.space:
+				continue
+			case <-stop:
+				return true
+			case <-timeout:
+				return false
+			}
+		default:
+			q.mu.Unlock()
+			return false
+		}
+		q.mu.Unlock()
+		return true
+	}
+}
+
+/*tryPut queues the data only if there's room for it*/
+func (q *sendQueue) tryPut(ch *Channel, dt interface{}) {
+	q.mu.Lock()
+	l := q.lane(ch)
+	if len(l.items) >= q.size {
+		q.mu.Unlock()
+		q.dropped.Add(1)
+		return
+	}
+	l.items = append(l.items, dt)
+	q.mu.Unlock()
+	notify(q.ready)
+}
+
+/*pushFront puts back what's left of a message taken from the lane*/
+func (q *sendQueue) pushFront(ch *Channel, dt interface{}) {
+	q.mu.Lock()
+	l := q.lane(ch)
+	l.items = append(l.items, nil)
+	copy(l.items[1:], l.items)
+	l.items[0] = dt
+	l.partial = true
+	q.mu.Unlock()
+}
+
+/*take removes the oldest message of the lane with the highest priority,
+ok is false if the queue is empty*/
+func (q *sendQueue) take() (dt interface{}, ok bool) {
+	q.mu.Lock()
+	for _, l := range q.lanes {
+		if len(l.items) == 0 {
+			continue
+		}
+		dt = l.items[0]
+		copy(l.items, l.items[1:])
+		l.items[len(l.items)-1] = nil
+		l.items = l.items[:len(l.items)-1]
+		l.partial = false
+		q.mu.Unlock()
+		notify(q.space)
+		return dt, true
+	}
+	q.mu.Unlock()
+	return nil, false
+}
+
+/*dropOldest drops the oldest message to make room for dt, a message
+partly written is kept, the peer would never get the rest of it. If
+there's nothing else to drop dt is dropped instead.*/
+func (l *lane) dropOldest(dt interface{}) {
+	i := 0
+	if l.partial {
+		i = 1
+	}
+	if i >= len(l.items) {
+		return
+	}
+	copy(l.items[i:], l.items[i+1:])
+	l.items[len(l.items)-1] = dt
+}
+
+/*replace overwrites the newest queued message with the same key*/
+func (l *lane) replace(dt interface{}) bool {
+	key, ok := queueKey(dt)
+	if !ok {
+		return false
+	}
+	for i := len(l.items) - 1; i >= 0; i-- {
+		if i == 0 && l.partial {
+			break
+		}
+		if k, ok := queueKey(l.items[i]); ok && k == key {
+			l.items[i] = dt
+			return true
+		}
+	}
+	return false
+}
+
+func queueKey(dt interface{}) (string, bool) {
+	if f, ok := dt.(*frame); ok {
+		dt = f.dt
+	}
+	k, ok := dt.(Keyed)
+	if !ok {
+		return "", false
+	}
+	return k.QueueKey(), true
+}
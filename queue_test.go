@@ -0,0 +1,195 @@
+package gna
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+/*drainOne takes the next message like the worker does, putting back
+what's left of a chunked one*/
+func drainOne(q *sendQueue) (interface{}, bool) {
+	dt, ok := q.take()
+	if !ok {
+		return nil, false
+	}
+	if b, ok := dt.(*bulk); ok {
+		dt = b.next()
+		if len(b.b) > 0 {
+			q.pushFront(b.ch, b)
+		}
+	}
+	return dt, true
+}
+
+type snapshot struct{ N int }
+
+func (snapshot) QueueKey() string { return "snapshot" }
+
+func TestQueueChunkedOverflow(t *testing.T) {
+	for _, o := range []Overflow{OverflowDropOldest, OverflowReplace} {
+		var q sendQueue
+		q.init(1, o, 0)
+		msg := bytes.Repeat([]byte{7}, 10)
+		q.put(Bulk, &bulk{ch: Bulk, id: 1, b: msg, size: 4}, nil)
+		first, _ := drainOne(&q)
+		// the lane is full with the rest of the message
+		for i := 0; i < 3; i++ {
+			q.put(Bulk, snapshot{i}, nil)
+		}
+		var got []byte
+		for {
+			dt, ok := drainOne(&q)
+			if !ok {
+				break
+			}
+			if c, ok := dt.(chunk); ok {
+				got = append(got, c.Data...)
+				continue
+			}
+			if dt != (snapshot{2}) {
+				t.Errorf("overflow %v: got %v", o, dt)
+			}
+		}
+		got = append(first.(chunk).Data, got...)
+		if !bytes.Equal(got, msg) {
+			t.Errorf("overflow %v: chunked message cut to %d bytes", o, len(got))
+		}
+	}
+}
+
+func TestQueueDropOldest(t *testing.T) {
+	var q sendQueue
+	q.init(2, OverflowDropOldest, 0)
+	for i := 1; i <= 3; i++ {
+		q.put(Gameplay, i, nil)
+	}
+	if a, _ := q.take(); a != 2 {
+		t.Fatal(a)
+	}
+	if b, _ := q.take(); b != 3 {
+		t.Fatal(b)
+	}
+	if q.dropped.Load() != 1 {
+		t.Fatal(q.dropped.Load())
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	tests := []struct {
+		o    Overflow
+		in   []interface{}
+		ok   bool
+		want []interface{}
+	}{
+		{OverflowDisconnect, []interface{}{1, 2, 3}, false, []interface{}{1, 2}},
+		{OverflowDropNewest, []interface{}{1, 2, 3}, true, []interface{}{1, 2}},
+		{OverflowReplace, []interface{}{snapshot{1}, "chat", snapshot{2}}, true, []interface{}{snapshot{2}, "chat"}},
+		// nothing to replace, the oldest goes
+		{OverflowReplace, []interface{}{1, snapshot{1}, 2}, true, []interface{}{snapshot{1}, 2}},
+	}
+	for _, tt := range tests {
+		var q sendQueue
+		q.init(2, tt.o, 0)
+		ok := true
+		for _, dt := range tt.in {
+			ok = q.put(Gameplay, dt, nil)
+		}
+		if ok != tt.ok {
+			t.Errorf("overflow %v: put returned %v", tt.o, ok)
+		}
+		for _, want := range tt.want {
+			if dt, _ := q.take(); dt != want {
+				t.Errorf("overflow %v: got %v, want %v", tt.o, dt, want)
+			}
+		}
+		if _, ok := q.take(); ok {
+			t.Errorf("overflow %v: more queued than expected", tt.o)
+		}
+	}
+}
+
+func TestQueueReplaceFrame(t *testing.T) {
+	var q sendQueue
+	q.init(1, OverflowReplace, 0)
+	q.put(Gameplay, &frame{dt: snapshot{1}}, nil)
+	q.put(Gameplay, &frame{dt: snapshot{2}}, nil)
+	dt, _ := q.take()
+	if f, ok := dt.(*frame); !ok || f.dt != (snapshot{2}) || q.dropped.Load() != 1 {
+		t.Fatal(dt, q.dropped.Load())
+	}
+}
+
+func TestQueueBlock(t *testing.T) {
+	var q sendQueue
+	q.init(1, OverflowBlock, 50*time.Millisecond)
+	q.put(Gameplay, 1, nil)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.take()
+	}()
+	if !q.put(Gameplay, 2, nil) {
+		t.Fatal("no room after take")
+	}
+	start := time.Now()
+	if q.put(Gameplay, 3, nil) {
+		t.Fatal("no timeout")
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("gave up after %v", d)
+	}
+	stop := make(chan struct{})
+	close(stop)
+	if !q.put(Gameplay, 4, stop) {
+		t.Fatal("stop should end the wait without closing")
+	}
+}
+
+func TestQueueBlockZeroWait(t *testing.T) {
+	var q sendQueue
+	q.init(1, OverflowBlock, 0)
+	q.put(Gameplay, 1, nil)
+	done := make(chan bool)
+	go func() { done <- q.put(Gameplay, 2, nil) }()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("no room, put should fail")
+		}
+	case <-time.After(stdBlockWait + time.Second):
+		t.Fatal("zero wait blocked forever")
+	}
+}
+
+func TestQueuePriority(t *testing.T) {
+	var q sendQueue
+	q.init(4, OverflowDisconnect, 0)
+	q.put(Bulk, "bulk", nil)
+	q.put(Gameplay, "gameplay", nil)
+	q.put(Control, "control", nil)
+	q.put(Gameplay, "gameplay2", nil)
+	for _, want := range []string{"control", "gameplay", "gameplay2", "bulk"} {
+		if dt, _ := q.take(); dt != want {
+			t.Fatalf("got %v, want %v", dt, want)
+		}
+	}
+}
+
+func TestGroupShipBlocked(t *testing.T) {
+	c, peer := net.Pipe()
+	defer peer.Close()
+	p := newPlayer(1, c, Gob, 1)
+	p.SetOverflow(OverflowBlock, 200*time.Millisecond)
+	g := NewGroup(p)
+	g.ship(1)
+	go g.ship(2) // nobody reads, it waits for room
+	time.Sleep(20 * time.Millisecond)
+	n := make(chan int)
+	go func() { n <- g.Len() }()
+	select {
+	case <-n:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("group locked while shipping")
+	}
+}
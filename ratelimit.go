@@ -0,0 +1,244 @@
+package gna
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+/*ErrRateLimited is the error of a player closed by RateDisconnect*/
+var ErrRateLimited = errors.New("gna: rate limit exceeded")
+
+var errDropped = errors.New("gna: message dropped")
+
+/*RatePolicy decides what happens to the messages of a player
+that goes over its RateLimit*/
+type RatePolicy int
+
+const (
+	RateDrop       RatePolicy = iota // the message is discarded
+	RateDelay                        // the message waits until it's within the limit, and so does the connection
+	RateDisconnect                   // the player is closed with DisconnectRateLimited
+)
+
+/*RateLimit bounds the messages each player may send per second, measured
+with a token bucket. Messages and Bytes are the rates, zero for no limit.
+Burst is how much of the rate can be spent at once, one second if zero.
+The control messages of gna, like heartbeats and calls, are counted as
+well, so leave room for them.
+Messages received through UDP are dropped regardless of the policy,
+unless it's RateDisconnect. The chunks of a message sent on a Channel with
+a Chunk size are charged to the Bytes rate as they arrive, over it they're
+delayed unless the policy is RateDisconnect.*/
+type RateLimit struct {
+	Messages float64 // per second
+	Bytes    float64 // per second
+	Burst    time.Duration
+	Policy   RatePolicy
+}
+
+/*RateStats are the counters of the rate limiter of a player*/
+type RateStats struct {
+	Messages uint64        // accepted
+	Bytes    uint64        // accepted
+	Dropped  uint64        // by RateDrop
+	Delayed  uint64        // by RateDelay
+	Waited   time.Duration // by RateDelay, in total
+}
+
+/*WithRateLimit sets the rate limit of the players set to the instance,
+it can be changed later with Net.SetRateLimit*/
+func WithRateLimit(r RateLimit) InstanceOption {
+	return func(n *Net) {
+		n.rate = r
+	}
+}
+
+/*SetRateLimit changes the rate limit of the players set to the instance
+from now on, the ones already in it keep the previous one*/
+func (n *Net) SetRateLimit(r RateLimit) {
+	n.mu.Lock()
+	n.rate = r
+	n.mu.Unlock()
+}
+
+/*RateStats returns the counters of the rate limiter of the player,
+they're kept when it moves to another instance*/
+func (p *Player) RateStats() RateStats {
+	p.rl.mu.Lock()
+	defer p.rl.mu.Unlock()
+	return p.rl.stats
+}
+
+/*throttle applies the rate limit to a message of the size given, it
+returns false if the message must be discarded, along with ErrRateLimited
+if the player must be closed as well*/
+func (p *dispatcher) throttle(size int) (bool, error) {
+	wait, err := p.rl.reserve(size, time.Now(), true)
+	if err == errDropped {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return p.sleep(wait), nil
+}
+
+/*throttleChunk charges a chunk of a message to the byte rate, a part of a
+message can't be dropped, so it waits unless the policy is RateDisconnect*/
+func (p *dispatcher) throttleChunk(size int) error {
+	wait, err := p.rl.reserveBytes(size, time.Now())
+	if err != nil {
+		return err
+	}
+	if !p.sleep(wait) {
+		return net.ErrClosed
+	}
+	return nil
+}
+
+/*sleep waits for the duration, it returns false if the connection
+is closed meanwhile*/
+func (p *dispatcher) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-p.closedChan():
+		return false
+	}
+}
+
+/*throttleUnreliable is like throttle, but it never waits*/
+func (p *Player) throttleUnreliable(size int) (bool, error) {
+	_, err := p.rl.reserve(size, time.Now(), false)
+	if err == errDropped {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type rateLimiter struct {
+	cfg   RateLimit
+	msgs  tokenBucket
+	bytes tokenBucket
+	stats RateStats
+	mu    sync.Mutex
+}
+
+/*configure sets a new limit, the buckets start full*/
+func (r *rateLimiter) configure(cfg RateLimit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cfg == cfg {
+		return
+	}
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = time.Second
+	}
+	r.cfg = cfg
+	r.msgs = newTokenBucket(cfg.Messages, burst)
+	r.bytes = newTokenBucket(cfg.Bytes, burst)
+}
+
+/*reserve takes the tokens for a message that can be handled after wait,
+errDropped means it must be discarded and ErrRateLimited that the player
+must be closed*/
+func (r *rateLimiter) reserve(size int, now time.Time, canWait bool) (wait time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := float64(size)
+	wait = r.msgs.need(1, now)
+	if w := r.bytes.need(n, now); w > wait {
+		wait = w
+	}
+	if wait <= 0 {
+		r.take(n)
+		return 0, nil
+	}
+	switch {
+	case r.cfg.Policy == RateDisconnect:
+		return 0, ErrRateLimited
+	case r.cfg.Policy == RateDelay && canWait:
+		r.take(n)
+		r.stats.Delayed++
+		r.stats.Waited += wait
+		return wait, nil
+	}
+	r.stats.Dropped++
+	return 0, errDropped
+}
+
+/*reserveBytes takes the tokens for a chunk, the message it belongs
+to is counted once complete*/
+func (r *rateLimiter) reserveBytes(size int, now time.Time) (wait time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := float64(size)
+	wait = r.bytes.need(n, now)
+	if wait > 0 && r.cfg.Policy == RateDisconnect {
+		return 0, ErrRateLimited
+	}
+	r.bytes.take(n)
+	r.stats.Bytes += uint64(size)
+	if wait > 0 {
+		r.stats.Delayed++
+		r.stats.Waited += wait
+	}
+	return wait, nil
+}
+
+func (r *rateLimiter) take(size float64) {
+	r.msgs.take(1)
+	r.bytes.take(size)
+	r.stats.Messages++
+	r.stats.Bytes += uint64(size)
+}
+
+/*tokenBucket refills at rate tokens per second up to burst tokens,
+tokens can go below zero when a delayed message takes them in advance.
+A zero rate means there's no limit.*/
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst time.Duration) tokenBucket {
+	b := math.Max(rate*burst.Seconds(), 1)
+	return tokenBucket{rate: rate, burst: b, tokens: b}
+}
+
+/*need returns how long until there are n tokens, 0 if they're available*/
+func (b *tokenBucket) need(n float64, now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	// a message larger than the burst goes through once the bucket is full
+	n = math.Min(n, b.burst)
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take(n float64) {
+	if b.rate > 0 {
+		b.tokens -= n
+	}
+}
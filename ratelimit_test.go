@@ -0,0 +1,81 @@
+package gna
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(10, time.Second)
+	for i := 0; i < 10; i++ {
+		if w := b.need(1, now); w != 0 {
+			t.Fatalf("token %d: wait %v", i, w)
+		}
+		b.take(1)
+	}
+	if w := b.need(1, now); w != 100*time.Millisecond {
+		t.Fatalf("empty bucket: wait %v", w)
+	}
+	// refills at the rate, up to the burst
+	if w := b.need(1, now.Add(100*time.Millisecond)); w != 0 {
+		t.Fatalf("refilled: wait %v", w)
+	}
+	if b.need(1, now.Add(time.Hour)); b.tokens != b.burst {
+		t.Fatalf("tokens %v over the burst %v", b.tokens, b.burst)
+	}
+	// a delayed message takes the tokens in advance
+	b.take(15)
+	if w := b.need(1, now.Add(time.Hour)); w != 600*time.Millisecond {
+		t.Fatalf("in debt: wait %v", w)
+	}
+	// larger than the burst, it waits for a full bucket
+	b = newTokenBucket(10, time.Second)
+	if w := b.need(1000, now); w != 0 {
+		t.Fatalf("large message: wait %v", w)
+	}
+	// no rate, no limit
+	b = newTokenBucket(0, time.Second)
+	b.take(1e9)
+	if w := b.need(1e9, now); w != 0 {
+		t.Fatalf("no rate: wait %v", w)
+	}
+}
+
+func TestRateLimiterPolicies(t *testing.T) {
+	now := time.Now()
+	var r rateLimiter
+	r.configure(RateLimit{Messages: 10, Policy: RateDrop})
+	ok := 0
+	for i := 0; i < 30; i++ {
+		if _, err := r.reserve(1, now, true); err == nil {
+			ok++
+		}
+	}
+	if ok != 10 || r.stats.Dropped != 20 || r.stats.Messages != 10 {
+		t.Fatal(ok, r.stats)
+	}
+
+	r.configure(RateLimit{Bytes: 100, Policy: RateDelay})
+	if w, err := r.reserve(100, now, true); w != 0 || err != nil {
+		t.Fatal(w, err)
+	}
+	if w, err := r.reserve(50, now, true); w != 500*time.Millisecond || err != nil {
+		t.Fatal(w, err)
+	}
+	// without waiting it's dropped
+	if _, err := r.reserve(50, now, false); err != errDropped {
+		t.Fatal(err)
+	}
+
+	r.configure(RateLimit{Bytes: 10, Policy: RateDisconnect})
+	if _, err := r.reserve(1000, now, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.reserve(1, now, true); err != ErrRateLimited {
+		t.Fatal(err)
+	}
+	if _, err := r.reserveBytes(1, now); err != ErrRateLimited {
+		t.Fatal(err)
+	}
+}
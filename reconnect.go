@@ -0,0 +1,215 @@
+package gna
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+/*ConnState is the state of the connection of a Client*/
+type ConnState int
+
+const (
+	/*Connecting is emitted before each attempt to reconnect*/
+	Connecting ConnState = iota
+	/*Connected is emitted once the Client is connected and the handshake is done*/
+	Connected
+	/*Reconnecting is emitted when the connection is lost and the Client will try again*/
+	Reconnecting
+	/*Closed is emitted once, when the Client gives up for good*/
+	Closed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Connected:
+		return "connected"
+	case Reconnecting:
+		return "reconnecting"
+	case Closed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+/*ConnEvent is a change in the state of the connection,
+Err is the error that caused it, if any*/
+type ConnEvent struct {
+	State ConnState
+	Err   error
+}
+
+/*Backoff is the policy used by a reconnecting Client: the delay starts at
+Min, doubles after each failed attempt up to Max and is reduced by up to
+Jitter (a fraction between 0 and 1) at random, so clients dropped together
+do not come back together. Min defaults to 100ms, Max to 30s and
+MaxAttempts of 0 means it never gives up.*/
+type Backoff struct {
+	Min         time.Duration
+	Max         time.Duration
+	Jitter      float64
+	MaxAttempts int
+}
+
+const (
+	stdMinBackoff = 100 * time.Millisecond
+	stdMaxBackoff = 30 * time.Second
+)
+
+/*delay returns the time to wait before the attempt*/
+func (b *Backoff) delay(attempt int) time.Duration {
+	d, top := b.Min, b.Max
+	if d <= 0 {
+		d = stdMinBackoff
+	}
+	if top <= 0 {
+		top = stdMaxBackoff
+	}
+	for i := 0; i < attempt && d < top; i++ {
+		d *= 2
+	}
+	if d > top {
+		d = top
+	}
+	if b.Jitter > 0 {
+		d -= time.Duration(b.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+/*resumeBackoff is used by WithResume alone, bounded by the grace period*/
+var resumeBackoff = Backoff{Min: 250 * time.Millisecond, Max: 2 * time.Second, Jitter: 0.2}
+
+/*WithReconnect makes the Client redial when the connection fails, waiting
+between attempts according to the Backoff, until it connects or gives up.
+Each new connection goes through the handshake given to WithHandshake.
+Use Client.Events to follow the state of the connection.*/
+func WithReconnect(b Backoff) DialOption {
+	return func(c *dialConfig) {
+		c.backoff = &b
+	}
+}
+
+/*WithHandshake sets the exchange done right after each connection, before
+the Client is started or resumes its work, like sending the credentials
+expected by Auth. Send and Recv can be used inside it.*/
+func WithHandshake(f func(*Client) error) DialOption {
+	return func(c *dialConfig) {
+		c.handshake = f
+	}
+}
+
+/*Events returns the channel where the changes in the state of the
+connection are emitted. The channel is buffered and events are dropped
+if nobody is reading them.*/
+func (c *Client) Events() <-chan ConnEvent {
+	return c.events
+}
+
+func (c *Client) emit(s ConnState, err error) {
+	select {
+	case c.events <- ConnEvent{State: s, Err: err}:
+	default:
+	}
+}
+
+/*handshake runs the handshake of the configuration, if any*/
+func (c *Client) handshake() error {
+	if c.cfg.handshake == nil {
+		return nil
+	}
+	c.handshaking.Store(true)
+	defer c.handshaking.Store(false)
+	return c.cfg.handshake(c)
+}
+
+/*reconnect is called by the receiver when the connection fails, it tries
+to resume the session, if any, or to start a new one with the backoff of
+the configuration. It returns false if the Client must be closed.*/
+func (c *Client) reconnect() bool {
+	c.closeConn()
+	c.mu.Lock()
+	stopped, tok := c.stopped, c.session
+	c.mu.Unlock()
+	<-stopped
+	canResume := c.cfg.resume && tok.Token != ""
+	if c.final.Load() || (c.cfg.backoff == nil && !canResume) {
+		return false
+	}
+	c.emit(Reconnecting, c.err)
+	b := c.cfg.backoff
+	var deadline time.Time
+	if b == nil {
+		b = &resumeBackoff
+		deadline = time.Now().Add(time.Duration(tok.Grace) * time.Millisecond)
+	}
+	for attempt := 0; ; attempt++ {
+		if c.final.Load() ||
+			(b.MaxAttempts > 0 && attempt >= b.MaxAttempts) ||
+			(!deadline.IsZero() && time.Now().After(deadline)) {
+			return false
+		}
+		c.emit(Connecting, nil)
+		var err error
+		if canResume {
+			err = c.resume(tok)
+		} else {
+			err = c.redial()
+		}
+		if err == nil {
+			c.err = nil
+			c.mu.Lock()
+			c.cause = nil
+			c.mu.Unlock()
+			go c.work()
+			if c.cfg.udp {
+				c.Dispatch(udpRequest{Want: true})
+			}
+			c.emit(Connected, nil)
+			return true
+		}
+		c.err = err
+		if errors.Is(err, errResumeRefused) {
+			if c.cfg.backoff == nil {
+				return false
+			}
+			canResume = false // the session is gone, start a new one
+			continue
+		}
+		t := time.NewTimer(b.delay(attempt))
+		select {
+		case <-t.C:
+		case <-c.quit:
+			t.Stop()
+			return false
+		}
+	}
+}
+
+/*redial opens a new connection and starts a new session on it*/
+func (c *Client) redial() error {
+	conn, err := c.cfg.connect(c.addr)
+	if err != nil {
+		return err
+	}
+	c.reset(conn)
+	c.mu.Lock()
+	c.session = resumeToken{}
+	c.mu.Unlock()
+	if c.cfg.resume {
+		err = c.dispatcher.Send(resumeHello{})
+	}
+	if err == nil {
+		err = c.login()
+	}
+	if err == nil {
+		err = c.handshake()
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	return nil
+}
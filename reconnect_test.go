@@ -0,0 +1,73 @@
+package gna
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		b       Backoff
+		attempt int
+		want    time.Duration
+	}{
+		{Backoff{Min: time.Second, Max: time.Minute}, 0, time.Second},
+		{Backoff{Min: time.Second, Max: time.Minute}, 3, 8 * time.Second},
+		{Backoff{Min: time.Second, Max: time.Minute}, 10, time.Minute},
+		{Backoff{}, 0, stdMinBackoff},
+		{Backoff{}, 1000, stdMaxBackoff},
+		{Backoff{Min: time.Second}, 4, 16 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := tt.b.delay(tt.attempt); got != tt.want {
+			t.Errorf("%+v, attempt %d: got %v, want %v", tt.b, tt.attempt, got, tt.want)
+		}
+	}
+	b := Backoff{Min: time.Second, Max: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if d := b.delay(i); d <= 500*time.Millisecond || d > time.Second {
+			t.Fatalf("jitter out of range: %v", d)
+		}
+	}
+}
+
+func TestReconnectClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+	c, err := Dial(ln.Addr().String(), WithReconnect(Backoff{Min: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	// the server goes away, the redial fails and the Client waits an hour
+	ln.Close()
+	(<-accepted).Close()
+	for ev := range c.Events() {
+		if ev.State == Connecting {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	c.Close()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev := <-c.Events():
+			if ev.State == Closed {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Close did not end the wait between attempts")
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package gna
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net"
+	"time"
+)
+
+/*Session resumption lets a Client take back its Player after losing the
+connection: once started, the Player receives a token, and a Client using
+WithResume greets every new connection with a resumeHello, empty for new
+sessions or carrying the token to take the place of a suspended Player.
+*/
+
+var errResumeRefused = errors.New("resume refused")
+
+/*SetResumeGrace enables session resumption for every Player started after
+the call. When the connection of a Player fails, it stays in its instance
+for the grace period, with outgoing messages kept in its queue, and Disconn
+is only called if the Client does not come back in time. Players closed on
+purpose are never suspended. Zero, the default, disables it.
+Clients must be dialed with WithResume while it's enabled.*/
+func (s *Server) SetResumeGrace(d time.Duration) {
+	s.mu.Lock()
+	s.grace = d
+	s.mu.Unlock()
+}
+
+func (s *Server) resumeGrace() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.grace
+}
+
+func newToken() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+/*tryResume reads the greeting of a new connection, if it carries a token
+the connection is given to the suspended Player, otherwise the greeting is
+discarded and the connection goes through Auth. The auth timer is stopped
+before the connection is given away. It returns true if the new connection
+should not go through Auth.*/
+func (s *Server) tryResume(p *Player, expired func() bool) bool {
+	dt, err := p.Recv()
+	if err != nil {
+		p.Close()
+		s.players.Rm(p.ID)
+		return true
+	}
+	hello, ok := dt.(resumeHello)
+	if !ok {
+		p.unread = dt // not a Client using WithResume
+		return false
+	}
+	if hello.Token == "" {
+		return false
+	}
+	s.players.Rm(p.ID) // p only carried the connection
+	if expired() {
+		p.Close()
+		return true
+	}
+	old := s.players.get(hello.ID)
+	if old == nil || !old.reattach(hello.Token, p.conn) {
+		p.Send(resumeAck{OK: false})
+		p.Close()
+	}
+	return true
+}
+
+/*reattach replaces the connection of the player, if the token is right
+and the player is, or becomes, suspended*/
+func (p *Player) reattach(token string, c net.Conn) bool {
+	if p.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(p.token)) != 1 {
+		return false
+	}
+	if !p.park() {
+		return false
+	}
+	p.mu.Lock()
+	if !p.suspended || p.final.Load() {
+		p.mu.Unlock()
+		return false
+	}
+	p.suspended = false
+	p.timer.Stop()
+	p.mu.Unlock()
+
+	p.reset(c)
+	p.err = nil
+	p.dispatcher.err = nil
+	p.reason.Store(int32(DisconnectUnknown)) // the failure was not the end
+	if err := p.Send(resumeAck{OK: true}); err != nil {
+		p.closeConn()
+		p.mu.Lock()
+		p.suspended = true
+		p.timer.Reset(p.srv.resumeGrace())
+		p.mu.Unlock()
+		return true // the connection is gone, but the token was right
+	}
+	p.srv.conns.Add(2)
+	p.start()
+	p.srv.conns.Done() // the suspension is over
+	return true
+}
+
+/*park makes sure the player is suspended, closing its connection if it's
+still open, which happens when the client notices the failure first*/
+func (p *Player) park() bool {
+	p.mu.Lock()
+	if p.suspended {
+		p.mu.Unlock()
+		return true
+	}
+	parked := p.parked
+	p.mu.Unlock()
+	p.closeConn()
+	select {
+	case <-parked:
+		return true
+	case <-time.After(5 * time.Second):
+		return false
+	}
+}
+
+/*suspend keeps the player in its instance after the connection failed,
+it returns false if the player must be disconnected instead*/
+func (p *Player) suspend() bool {
+	grace := p.srv.resumeGrace()
+	if grace <= 0 || p.token == "" {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.final.Load() {
+		return false
+	}
+	p.suspended = true
+	p.srv.conns.Add(1)
+	p.timer = time.AfterFunc(grace, p.expire)
+	close(p.parked)
+	return true
+}
+
+/*expire disconnects the suspended player*/
+func (p *Player) expire() {
+	p.mu.Lock()
+	if !p.suspended {
+		p.mu.Unlock()
+		return
+	}
+	p.suspended = false
+	p.mu.Unlock()
+	p.final.Store(true)
+	p.disc()
+	p.srv.conns.Done()
+}
+
+/*wake ends the suspension at once, the player was closed on purpose*/
+func (p *Player) wake() {
+	p.mu.Lock()
+	if p.suspended {
+		p.timer.Reset(0)
+	}
+	p.mu.Unlock()
+}
+
+/*WithResume makes the Client take back its Player when the connection
+fails, as long as it reconnects within the grace period of the server
+(see Server.SetResumeGrace). Meanwhile Dispatch drops the data.
+Combined with WithReconnect, a fresh session is started when the
+session cannot be resumed.*/
+func WithResume() DialOption {
+	return func(c *dialConfig) {
+		c.resume = true
+	}
+}
+
+/*resume opens a new connection and presents the token*/
+func (c *Client) resume(tok resumeToken) error {
+	conn, err := c.cfg.connect(c.addr)
+	if err != nil {
+		return err
+	}
+	c.reset(conn)
+	err = c.dispatcher.Send(resumeHello{ID: tok.ID, Token: tok.Token})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	dt, err := c.dispatcher.Recv()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if ack, ok := dt.(resumeAck); !ok || !ack.OK {
+		conn.Close()
+		return errResumeRefused
+	}
+	return nil
+}
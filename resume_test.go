@@ -0,0 +1,124 @@
+package gna
+
+import (
+	"testing"
+	"time"
+)
+
+/*resumeClient dials with WithResume and waits for the session token*/
+func resumeClient(t *testing.T, addr string) (*Client, resumeToken) {
+	c, err := Dial(addr, WithResume())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.Start()
+	var tok resumeToken
+	waitFor(t, "the resume token", func() bool {
+		c.mu.Lock()
+		tok = c.session
+		c.mu.Unlock()
+		return tok.Token != ""
+	})
+	return c, tok
+}
+
+/*cut closes the connection of the client as a network failure would*/
+func cut(c *Client) {
+	c.mu.Lock()
+	c.conn.Close()
+	c.mu.Unlock()
+}
+
+func TestResume(t *testing.T) {
+	ins := &testIns{}
+	srv, addr := serveTest(t, ins)
+	srv.SetResumeGrace(time.Minute)
+	c, tok := resumeClient(t, addr)
+	p := srv.players.get(tok.ID)
+	if p == nil {
+		t.Fatal("no player")
+	}
+	cut(c)
+	reconnected := false
+	for ev := range c.Events() {
+		if ev.State == Reconnecting {
+			reconnected = true
+		}
+		if ev.State == Closed {
+			t.Fatal(ev.Err)
+		}
+		if reconnected && ev.State == Connected {
+			break
+		}
+	}
+	c.Dispatch("again")
+	var got []interface{}
+	waitFor(t, "the echo", func() bool {
+		got = append(got, c.RecvBatch()...)
+		return len(got) > 0
+	})
+	if len(got) != 1 || got[0] != "again" {
+		t.Fatal(got)
+	}
+	if ins.disc.Load() != 0 || ins.Players.Len() != 1 || srv.players.get(tok.ID) != p {
+		t.Fatal("the player was replaced")
+	}
+	if r := p.Reason(); r != DisconnectUnknown {
+		t.Fatal("reason kept after resuming:", r)
+	}
+}
+
+func TestResumeExpire(t *testing.T) {
+	ins := &testIns{}
+	srv, addr := serveTest(t, ins)
+	srv.SetResumeGrace(200 * time.Millisecond)
+	c, tok := resumeClient(t, addr)
+	c.final.Store(true) // it never comes back
+	cut(c)
+	p := srv.players.get(tok.ID)
+	waitFor(t, "the suspension", func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.suspended
+	})
+	if ins.disc.Load() != 0 || ins.Players.Len() != 1 {
+		t.Fatal("disconnected before the grace period")
+	}
+	waitFor(t, "Disconn", func() bool { return ins.disc.Load() == 1 })
+	if srv.players.get(tok.ID) != nil {
+		t.Fatal("expired player still listed")
+	}
+}
+
+func TestResumeClosed(t *testing.T) {
+	ins := &testIns{}
+	srv, addr := serveTest(t, ins)
+	srv.SetResumeGrace(time.Minute)
+	c, tok := resumeClient(t, addr)
+	c.final.Store(true)
+	cut(c)
+	p := srv.players.get(tok.ID)
+	waitFor(t, "the suspension", func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.suspended
+	})
+	// closed on purpose, the grace period is over
+	p.Close()
+	waitFor(t, "Disconn", func() bool { return ins.disc.Load() == 1 })
+	if p.reattach(tok.Token, nil) {
+		t.Fatal("reattached after Disconn")
+	}
+}
+
+func TestReattachToken(t *testing.T) {
+	p := pipePlayer(t, 1)
+	if p.reattach("", nil) {
+		t.Fatal("reattached without resumption")
+	}
+	p.token = newToken()
+	if p.reattach(newToken(), nil) {
+		t.Fatal("reattached with the wrong token")
+	}
+}
@@ -0,0 +1,92 @@
+package gna
+
+import "reflect"
+
+/*Router calls the handler registered for the type of each message instead
+of a type switch over interface{}. S is the sender of the messages: *Player
+inside an Instance, *Client on the client side. Handlers must be registered
+before the Router is used.*/
+type Router[S any] struct {
+	handlers map[reflect.Type]func(S, interface{})
+	ifaces   []ifaceHandler[S] // handlers of interface types, tried in order
+	fallback func(S, interface{})
+}
+
+type ifaceHandler[S any] struct {
+	t reflect.Type
+	f func(S, interface{})
+}
+
+/*NewRouter creates an empty Router*/
+func NewRouter[S any]() *Router[S] {
+	return &Router[S]{handlers: make(map[reflect.Type]func(S, interface{}), 8)}
+}
+
+/*Handle registers the handler for messages of type T, replacing
+the previous one, if any. If T is an interface, the handler receives
+every message implementing it that has no handler of its own.*/
+func Handle[S, T any](r *Router[S], f func(from S, msg T)) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	h := func(from S, dt interface{}) {
+		f(from, dt.(T))
+	}
+	if t.Kind() == reflect.Interface {
+		r.ifaces = append(r.ifaces, ifaceHandler[S]{t, h})
+		return
+	}
+	r.handlers[t] = h
+}
+
+/*Fallback sets the handler for messages of types without one,
+by default they're ignored*/
+func (r *Router[S]) Fallback(f func(from S, msg interface{})) {
+	r.fallback = f
+}
+
+/*Route calls the handler for the type of the message*/
+func (r *Router[S]) Route(from S, dt interface{}) {
+	if h := r.handler(dt); h != nil {
+		h(from, dt)
+		return
+	}
+	if r.fallback != nil {
+		r.fallback(from, dt)
+	}
+}
+
+/*RouteAll routes each message of the batch, as returned by Client.RecvBatch*/
+func (r *Router[S]) RouteAll(from S, batch []interface{}) {
+	for _, dt := range batch {
+		r.Route(from, dt)
+	}
+}
+
+/*Accepts reports if there's a handler for the type of the message,
+it can be given to Net.SetFilter or WithFilter to drop the messages of
+unregistered types as soon as they're decoded.*/
+func (r *Router[S]) Accepts(dt interface{}) bool {
+	return r.handler(dt) != nil
+}
+
+func (r *Router[S]) handler(dt interface{}) func(S, interface{}) {
+	if dt == nil {
+		return nil
+	}
+	t := reflect.TypeOf(dt)
+	if h, ok := r.handlers[t]; ok {
+		return h
+	}
+	for _, ih := range r.ifaces {
+		if t.Implements(ih.t) {
+			return ih.f
+		}
+	}
+	return nil
+}
+
+/*RouteInputs routes the data of each Input, as returned by Net.GetData*/
+func RouteInputs(r *Router[*Player], inputs []*Input) {
+	for _, in := range inputs {
+		r.Route(in.P, in.Data)
+	}
+}
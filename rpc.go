@@ -0,0 +1,214 @@
+package gna
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*CallHandler answers the calls made by the players with Client.Call,
+it runs in a goroutine of its own for each call. The context is done when
+the caller gives up, its deadline passes or the player disconnects.
+Returning a *RemoteError lets you choose the Code seen by the caller.
+A player may have up to 64 calls in progress, the ones over it fail
+with CodeBusy. The Disconn of a player waits for its calls to return,
+and the OnStop of the instance for every call, so the handler must
+return once the context is done.*/
+type CallHandler func(ctx context.Context, p *Player, req interface{}) (interface{}, error)
+
+/*Codes of the RemoteErrors created by gna itself*/
+const (
+	CodeNoHandler = "no_handler"
+	CodeCanceled  = "canceled"
+	CodeDeadline  = "deadline_exceeded"
+	CodeInternal  = "internal"
+	CodeBusy      = "busy" // the player has too many calls in progress
+)
+
+/*maxCalls is how many calls a player may have in progress at once*/
+const maxCalls = 64
+
+/*RemoteError is an error returned by the CallHandler on the server,
+use errors.As on the error of Client.Call to retrieve it*/
+type RemoteError struct {
+	Code    string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote error (%v): %v", e.Code, e.Message)
+}
+
+/*Is makes the errors of calls canceled or timed out on the server
+match context.Canceled and context.DeadlineExceeded*/
+func (e *RemoteError) Is(target error) bool {
+	switch e.Code {
+	case CodeDeadline:
+		return target == context.DeadlineExceeded
+	case CodeCanceled:
+		return target == context.Canceled
+	}
+	return false
+}
+
+func toRemote(err error) *RemoteError {
+	var re *RemoteError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &re):
+		return re
+	case errors.Is(err, context.DeadlineExceeded):
+		return &RemoteError{Code: CodeDeadline, Message: err.Error()}
+	case errors.Is(err, context.Canceled):
+		return &RemoteError{Code: CodeCanceled, Message: err.Error()}
+	}
+	return &RemoteError{Code: CodeInternal, Message: err.Error()}
+}
+
+/*HandleCalls sets the handler of the calls made by the players in the
+instance, players moved to another instance use the handler of their new instance.*/
+func (n *Net) HandleCalls(h CallHandler) {
+	n.mu.Lock()
+	n.calls = h
+	n.mu.Unlock()
+}
+
+/*callState keeps the calls in progress of a Player, so they can be canceled*/
+type callState struct {
+	pending map[uint64]context.CancelFunc
+	running sync.WaitGroup // waited before Disconn
+	mu      sync.Mutex
+}
+
+/*startCall counts a CallHandler about to run, it returns
+false if the instance was terminated*/
+func (n *Net) startCall() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	select {
+	case <-n.done:
+		return false
+	default:
+	}
+	n.callers.Add(1)
+	return true
+}
+
+/*call runs the handler and ships the response back*/
+func (p *Player) call(req callRequest) {
+	h := p.calls
+	if h == nil {
+		p.shipOn(Control, callResponse{ID: req.ID, Err: &RemoteError{Code: CodeNoHandler, Message: "no call handler"}})
+		return
+	}
+	n := p.ins.NetAbs()
+	if !n.startCall() {
+		p.shipOn(Control, callResponse{ID: req.ID, Err: &RemoteError{Code: CodeCanceled, Message: "instance terminated"}})
+		return
+	}
+	p.cs.mu.Lock()
+	_, dup := p.cs.pending[req.ID]
+	if dup || len(p.cs.pending) >= maxCalls {
+		p.cs.mu.Unlock()
+		n.callers.Done()
+		p.shipOn(Control, callResponse{ID: req.ID, Err: &RemoteError{Code: CodeBusy, Message: "too many calls in progress"}})
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if req.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Timeout)*time.Millisecond)
+	}
+	if p.cs.pending == nil {
+		p.cs.pending = make(map[uint64]context.CancelFunc, 4)
+	}
+	p.cs.pending[req.ID] = cancel
+	p.cs.running.Add(1)
+	p.cs.mu.Unlock()
+	go func() {
+		defer n.callers.Done()
+		defer p.cs.running.Done()
+		defer p.cancelCall(req.ID)
+		resp, err := h(ctx, p, req.Data.V)
+		if ctx.Err() == context.Canceled && err == nil {
+			return // nobody is waiting for it
+		}
+		p.shipOn(Control, callResponse{ID: req.ID, Data: anyValue{resp}, Err: toRemote(err)})
+	}()
+}
+
+func (p *Player) cancelCall(id uint64) {
+	p.cs.mu.Lock()
+	cancel, ok := p.cs.pending[id]
+	delete(p.cs.pending, id)
+	p.cs.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+/*cancelCalls cancels every call in progress, the player is gone*/
+func (p *Player) cancelCalls() {
+	p.cs.mu.Lock()
+	for id, cancel := range p.cs.pending {
+		cancel()
+		delete(p.cs.pending, id)
+	}
+	p.cs.mu.Unlock()
+}
+
+/*Call sends the request to the CallHandler of the instance of the Player
+and waits for the response. The deadline of the context is sent along,
+and if the context is done before the response arrives, the call is canceled
+on the server as well. Errors returned by the handler are *RemoteError.
+If used with a unstarted Client it panics.*/
+func (c *Client) Call(ctx context.Context, req interface{}) (interface{}, error) {
+	if !c.started {
+		panic("cannot call, client not started")
+	}
+	id := c.callID.Add(1)
+	ch := make(chan callResponse, 1)
+	c.calls.Store(id, ch)
+	defer c.calls.Delete(id)
+
+	msg := callRequest{ID: id, Data: anyValue{req}}
+	if dl, ok := ctx.Deadline(); ok {
+		msg.Timeout = time.Until(dl).Milliseconds()
+		if msg.Timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+	}
+	closed := c.closedChan()
+	c.q.put(Control, msg, closed)
+	select {
+	case resp := <-ch:
+		if resp.Err != nil {
+			return nil, resp.Err
+		}
+		return resp.Data.V, nil
+	case <-closed:
+		return nil, c.callErr()
+	case <-ctx.Done():
+		go c.DispatchOn(Control, callCancel{ID: id})
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) callErr() error {
+	if err := c.Error(); err != nil {
+		return fmt.Errorf("connection closed: %w", err)
+	}
+	return errors.New("connection closed")
+}
+
+/*response delivers the response to the waiting Call, if any*/
+func (c *Client) response(resp callResponse) {
+	if ch, ok := c.calls.Load(resp.ID); ok {
+		select {
+		case ch.(chan callResponse) <- resp:
+		default:
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package gna
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*callIns logs when the calls, Disconns and OnStop return*/
+type callIns struct {
+	testIns
+	log []string
+	mu  sync.Mutex
+}
+
+func (ins *callIns) add(s string) {
+	ins.mu.Lock()
+	ins.log = append(ins.log, s)
+	ins.mu.Unlock()
+}
+
+func (ins *callIns) Disconn(p *Player) { ins.add("disconn") }
+func (ins *callIns) OnStop()           { ins.add("stop") }
+
+func (ins *callIns) logged() []string {
+	ins.mu.Lock()
+	defer ins.mu.Unlock()
+	return append([]string(nil), ins.log...)
+}
+
+func TestCall(t *testing.T) {
+	ins := &callIns{}
+	ins.HandleCalls(func(ctx context.Context, p *Player, req interface{}) (interface{}, error) {
+		if req == "fail" {
+			return nil, &RemoteError{Code: "nope", Message: "failed"}
+		}
+		return req.(int) * 2, nil
+	})
+	_, addr := serveTest(t, ins)
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Start()
+	resp, err := c.Call(context.Background(), 21)
+	if err != nil || resp != 42 {
+		t.Fatal(resp, err)
+	}
+	_, err = c.Call(context.Background(), "fail")
+	var re *RemoteError
+	if !errors.As(err, &re) || re.Code != "nope" {
+		t.Fatal(err)
+	}
+}
+
+func TestCallOutlived(t *testing.T) {
+	for _, name := range []string{"disconnect", "shutdown"} {
+		t.Run(name, func(t *testing.T) {
+			ins := &callIns{}
+			started := make(chan struct{})
+			ins.HandleCalls(func(ctx context.Context, p *Player, req interface{}) (interface{}, error) {
+				close(started)
+				<-ctx.Done()
+				time.Sleep(50 * time.Millisecond) // still touching the game state
+				ins.add("call")
+				return nil, ctx.Err()
+			})
+			srv, addr := serveTest(t, ins)
+			c, err := Dial(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Start()
+			go c.Call(context.Background(), 1)
+			<-started
+			if name == "disconnect" {
+				srv.players.each(func(p *Player) { p.Close() })
+			}
+			if err := srv.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			c.Close()
+			log := ins.logged()
+			if len(log) != 3 || log[0] != "call" || log[1] != "disconn" || log[2] != "stop" {
+				t.Fatal(log)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package gna
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+/*ErrServerClosed is returned by Server.Serve after a call to Shutdown*/
+var ErrServerClosed = errors.New("gna: server closed")
+
+/*NewServer creates a Server without listeners, add them with Listen.*/
+func NewServer() *Server {
+	return &Server{
+		instances: make(map[Instance]struct{}, 4),
+		players:   &Group{pMap: make(map[uint64]*Player, 64)},
+		quit:      make(chan struct{}),
+		errc:      make(chan error, 1),
+		perIP:     make(map[string]int),
+		rejecting: make(chan struct{}, maxRejecting),
+	}
+}
+
+/*Server is your whole application, it owns the listeners, the players and
+the instances they were sent to. Every listener shares the same Player ID
+space, so players can be set to any instance regardless of where they came from.
+It does not handle signals, to stop it cancel the context given to Serve
+or call Shutdown.*/
+type Server struct {
+	idGen id
+
+	listeners []*listener
+	instances map[Instance]struct{}
+	players   *Group         // every connected player, authenticated or not
+	conns     sync.WaitGroup // auth, receiver and dispatcher goroutines
+	errc      chan error     // first error of a failing listener
+	quit      chan struct{}
+	serving   bool
+	closing   bool
+	grace     time.Duration // resume grace period, see SetResumeGrace
+	hb        Heartbeat     // see SetHeartbeat
+	adm       Admission     // see SetAdmission
+	bans      *BanList      // see SetBanList
+	pending   int           // connections going through the auth
+	perIP     map[string]int
+	rejecting chan struct{} // connections being told they were rejected
+	mu        sync.Mutex
+
+	udp        *net.UDPConn
+	udpPlayers map[uint64]*Player // players with an unreliable channel
+}
+
+/*Listen binds the address to a main Instance, the Auth of the instance
+is called for every player that connects through it. If the server is
+already serving, the players are accepted right away. The options are
+used when the server runs the instance, they're ignored if it's already running.*/
+func (s *Server) Listen(addr string, ins Instance, opts ...InstanceOption) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.addListener(&listener{mainIns: ins, srv: s, ln: ln, opts: opts})
+}
+
+/*ListenTLS is like Listen, but the players connect through TLS with the
+configuration given. To authenticate players by their certificates, set
+ClientAuth in the config and use Player.PeerCertificate inside Auth.*/
+func (s *Server) ListenTLS(addr string, ins Instance, cfg *tls.Config, opts ...InstanceOption) error {
+	ln, err := tls.Listen("tcp", addr, cfg)
+	if err != nil {
+		return err
+	}
+	return s.addListener(&listener{mainIns: ins, srv: s, ln: ln, opts: opts})
+}
+
+func (s *Server) addListener(l *listener) error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		if l.ln != nil {
+			l.ln.Close()
+		}
+		return ErrServerClosed
+	}
+	s.listeners = append(s.listeners, l)
+	serving := s.serving
+	s.mu.Unlock()
+	s.track(l.mainIns)
+	if serving {
+		s.run(l)
+	}
+	return nil
+}
+
+/*run starts the main instance of the listener, if needed, and accepts players,
+listeners without a net.Listener are fed by a http.Handler instead*/
+func (s *Server) run(l *listener) {
+	if startInstance(l.mainIns, l.opts) {
+		go runLoop(l.mainIns)
+	}
+	if l.ln == nil {
+		return
+	}
+	go func() {
+		if err := l.connRecv(); err != nil {
+			select {
+			case s.errc <- err:
+			default:
+			}
+		}
+	}()
+}
+
+/*Serve runs the main instances and accepts players on every listener
+until the context is done or Shutdown is called. When the context is done,
+the server is shut down before returning the context error, otherwise
+ErrServerClosed is returned. If a listener fails, the server is shut down
+and the error returned.*/
+func (s *Server) Serve(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closing || s.serving {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.serving = true
+	ls := append([]*listener(nil), s.listeners...)
+	s.mu.Unlock()
+
+	for _, l := range ls {
+		s.run(l)
+	}
+	select {
+	case <-ctx.Done():
+		s.Shutdown(context.Background())
+		return ctx.Err()
+	case <-s.quit:
+		return ErrServerClosed
+	case err := <-s.errc:
+		s.Shutdown(context.Background())
+		return err
+	}
+}
+
+/*Shutdown stops every listener, sends what's left in the queue of
+each Player before disconnecting them, waits for every Disconn and then
+terminates every Instance the players were in. It returns once all of it is
+done, or with the context error if the context ends first, in which case the
+remaining connections are closed abruptly.*/
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closing {
+		s.closing = true
+		close(s.quit)
+		for _, l := range s.listeners {
+			if l.ln != nil {
+				l.ln.Close()
+			}
+		}
+		if s.udp != nil {
+			s.udp.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	s.players.each(func(p *Player) {
+		p.setReason(DisconnectShutdown)
+		p.flush(disconnect{Reason: DisconnectShutdown})
+	})
+	if err := wait(ctx, s.conns.Wait); err != nil {
+		s.players.each(func(p *Player) {
+			p.Close()
+		})
+		return err
+	}
+
+	s.mu.Lock()
+	ins := make([]Instance, 0, len(s.instances))
+	for i := range s.instances {
+		ins = append(ins, i)
+	}
+	s.mu.Unlock()
+	for _, i := range ins {
+		i.Terminate()
+	}
+	for _, i := range ins {
+		if err := wait(ctx, i.NetAbs().wait); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*wait runs f and waits for it to return or the context to be done*/
+func wait(ctx context.Context, f func()) error {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+func (s *Server) isServing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.serving && !s.closing
+}
+
+/*track adds the instance to the ones terminated on Shutdown*/
+func (s *Server) track(ins Instance) {
+	s.mu.Lock()
+	s.instances[ins] = struct{}{}
+	s.mu.Unlock()
+}
+
+/*untrack forgets an instance that was already terminated*/
+func (s *Server) untrack(ins Instance) {
+	s.mu.Lock()
+	delete(s.instances, ins)
+	s.mu.Unlock()
+}
+
+/*admit registers a new connection, accounting for its auth goroutine,
+the caller must call conns.Done once it's done with the auth*/
+func (s *Server) admit(p *Player) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		p.Close()
+		return false
+	}
+	s.players.Add(p)
+	s.conns.Add(1)
+	return true
+}
+
+/*start starts the receiver and dispatcher of an authenticated player*/
+func (s *Server) start(p *Player) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		// the player is still in an instance, so it must go through Disconn
+		p.setReason(DisconnectShutdown)
+		p.flush(nil)
+	}
+	s.conns.Add(2)
+	p.start()
+	if s.grace > 0 && p.token == "" {
+		p.token = newToken()
+		p.shipOn(Control, resumeToken{ID: p.ID, Token: p.token, Grace: s.grace.Milliseconds()})
+	}
+}
@@ -0,0 +1,152 @@
+package gna
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+/*serveTest serves the instance on a free port until the test ends*/
+func serveTest(t *testing.T, ins Instance, opts ...InstanceOption) (*Server, string) {
+	srv := NewServer()
+	if err := srv.Listen("127.0.0.1:0", ins, opts...); err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(context.Background())
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	srv.mu.Lock()
+	addr := srv.listeners[0].ln.Addr().String()
+	srv.mu.Unlock()
+	return srv, addr
+}
+
+/*waitFor polls the condition until it holds, failing the test after a while*/
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+/*playersIn returns how many players are in the instance, which
+may still be starting*/
+func playersIn(ins Instance) int {
+	n := ins.NetAbs()
+	n.mu.Lock()
+	g := n.Players
+	n.mu.Unlock()
+	if g == nil {
+		return 0
+	}
+	return g.Len()
+}
+
+/*waitClosed waits for the Closed event of the client*/
+func waitClosed(t *testing.T, c *Client) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-c.Events():
+			if ev.State == Closed {
+				return
+			}
+		case <-timeout:
+			t.Fatal("the client was not closed")
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ins := &callIns{}
+	srv := NewServer()
+	if err := srv.Listen("127.0.0.1:0", ins); err != nil {
+		t.Fatal(err)
+	}
+	addr := srv.listeners[0].ln.Addr().String()
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(context.Background()) }()
+	var cs []*Client
+	for i := 0; i < 2; i++ {
+		c, err := Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		c.Start()
+		cs = append(cs, c)
+	}
+	waitFor(t, "the players", func() bool { return playersIn(ins) == 2 })
+	srv.players.each(func(p *Player) {
+		for i := 0; i < stdQueue/2; i++ {
+			p.ship(i)
+		}
+	})
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != ErrServerClosed {
+		t.Fatal(err)
+	}
+	// every queued message is sent before the players are disconnected
+	for _, c := range cs {
+		waitClosed(t, c)
+		got := c.RecvBatch()
+		if len(got) != stdQueue/2 {
+			t.Fatalf("got %d messages: %v", len(got), got)
+		}
+		for i, dt := range got {
+			if dt != i {
+				t.Fatalf("message %d is %v", i, dt)
+			}
+		}
+		var de *DisconnectError
+		if err := c.Error(); !errors.As(err, &de) || de.Reason != DisconnectShutdown {
+			t.Fatal(err)
+		}
+	}
+	// the instance stops after the Disconns
+	log := ins.logged()
+	if len(log) != 3 || log[0] != "disconn" || log[1] != "disconn" || log[2] != "stop" {
+		t.Fatal(log)
+	}
+	if err := srv.Listen("127.0.0.1:0", ins); err != ErrServerClosed {
+		t.Fatal(err)
+	}
+	if err := srv.Serve(context.Background()); err != ErrServerClosed {
+		t.Fatal(err)
+	}
+}
+
+/*stuckIns blocks in Disconn until released*/
+type stuckIns struct {
+	testIns
+	release chan struct{}
+}
+
+func (ins *stuckIns) Disconn(p *Player) { <-ins.release }
+
+func TestShutdownContext(t *testing.T) {
+	ins := &stuckIns{release: make(chan struct{})}
+	srv, addr := serveTest(t, ins)
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Start()
+	waitFor(t, "the player", func() bool { return playersIn(ins) == 1 })
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	close(ins.release)
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
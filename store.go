@@ -0,0 +1,86 @@
+package gna
+
+import "sync"
+
+/*Key identifies a value of type T stored in a Player, create it once with
+NewKey and share it between the instances that use the value:
+
+	var Username = gna.NewKey[string]("username")
+	...
+	Username.Set(p, "bob")
+	name, ok := Username.Get(p)
+
+The values travel with the Player across SetInstance and are released
+once Disconn returns.*/
+type Key[T any] struct {
+	id *keyID
+}
+
+/*keyID gives each key its own identity, the name is only informative*/
+type keyID struct {
+	name string
+}
+
+/*NewKey creates a new key, keys are distinct even if they share the name*/
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{&keyID{name}}
+}
+
+/*Name returns the name given to NewKey*/
+func (k Key[T]) Name() string {
+	return k.id.name
+}
+
+/*Get returns the value stored in the player, ok is false if there's none*/
+func (k Key[T]) Get(p *Player) (v T, ok bool) {
+	dt, ok := p.meta.get(k.id)
+	if !ok {
+		return v, false
+	}
+	return dt.(T), true
+}
+
+/*Set stores the value in the player, replacing the previous one*/
+func (k Key[T]) Set(p *Player, v T) {
+	p.meta.set(k.id, v)
+}
+
+/*Delete removes the value from the player*/
+func (k Key[T]) Delete(p *Player) {
+	p.meta.del(k.id)
+}
+
+/*metaStore holds the values of the keys set in a Player*/
+type metaStore struct {
+	m  map[*keyID]interface{}
+	mu sync.Mutex
+}
+
+func (s *metaStore) get(k *keyID) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dt, ok := s.m[k]
+	return dt, ok
+}
+
+func (s *metaStore) set(k *keyID, dt interface{}) {
+	s.mu.Lock()
+	if s.m == nil {
+		s.m = make(map[*keyID]interface{}, 4)
+	}
+	s.m[k] = dt
+	s.mu.Unlock()
+}
+
+func (s *metaStore) del(k *keyID) {
+	s.mu.Lock()
+	delete(s.m, k)
+	s.mu.Unlock()
+}
+
+/*clear releases every value*/
+func (s *metaStore) clear() {
+	s.mu.Lock()
+	s.m = nil
+	s.mu.Unlock()
+}
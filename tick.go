@@ -0,0 +1,174 @@
+package gna
+
+import "time"
+
+/*TickPolicy decides what the instance does when Update takes longer than a tick*/
+type TickPolicy int
+
+const (
+	/*TickDrop skips the ticks that were missed, the next Update runs at the
+	next tick of the original schedule. This is the default.*/
+	TickDrop TickPolicy = iota
+	/*TickCatchUp runs the missed ticks back to back, up to the limit given
+	to SetTickPolicy, the ones beyond it are dropped.*/
+	TickCatchUp
+	/*TickSlowDown never skips a tick, the schedule is shifted so the next
+	Update runs one step after the late one ended.*/
+	TickSlowDown
+)
+
+/*Tick describes the current Update, see Net.Tick*/
+type Tick struct {
+	Index    uint64        // number of the Update, starting at 0
+	Step     time.Duration // fixed timestep between ticks
+	Elapsed  time.Duration // real time since the previous Update began
+	Overruns uint64        // ticks that started late or were dropped so far
+	CatchUp  bool          // if this Update is catching up a missed tick
+}
+
+/*TickStats are the statistics of the Update durations of an instance*/
+type TickStats struct {
+	Count    uint64 // Updates run
+	Overruns uint64 // ticks that started late or were dropped
+	Dropped  uint64 // ticks skipped
+	Last     time.Duration
+	Min      time.Duration
+	Max      time.Duration
+	Mean     time.Duration
+}
+
+/*scheduler keeps the state of the fixed-timestep loop*/
+type scheduler struct {
+	policy   TickPolicy
+	maxCatch int
+	tick     Tick      // only touched by the instance goroutine
+	stats    TickStats // guarded by Net.mu
+	total    time.Duration
+	last     time.Time
+}
+
+/*SetTickPolicy sets what happens when Update overruns its tick, maxCatchUp
+bounds how many missed ticks TickCatchUp runs in a row.*/
+func (n *Net) SetTickPolicy(p TickPolicy, maxCatchUp int) {
+	n.mu.Lock()
+	n.sched.policy = p
+	n.sched.maxCatch = maxCatchUp
+	n.mu.Unlock()
+}
+
+/*Tick returns the metadata of the current tick, it's meant to be
+used inside Update*/
+func (n *Net) Tick() Tick {
+	return n.sched.tick
+}
+
+/*TickStats returns the statistics of the Updates run so far*/
+func (n *Net) TickStats() TickStats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.sched.stats
+}
+
+/*step returns the time between ticks*/
+func (n *Net) step() time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return time.Second / time.Duration(n.tps)
+}
+
+/*tickLoop calls Update at a fixed timestep until Terminate*/
+func (n *Net) tickLoop(ins Instance) {
+	step := n.step()
+	next := time.Now().Add(step)
+	timer := time.NewTimer(step)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-n.done:
+			return
+		}
+		now := time.Now()
+		n.mu.Lock()
+		policy, maxCatch := n.sched.policy, n.sched.maxCatch
+		n.mu.Unlock()
+		behind := uint64(0) // whole ticks missed after this one
+		if late := now.Sub(next); late >= step {
+			behind = uint64(late / step)
+		}
+		runs := uint64(1)
+		switch policy {
+		case TickDrop:
+			n.overrun(behind, behind)
+			next = next.Add(time.Duration(behind+1) * step)
+		case TickCatchUp:
+			runs += behind
+			if behind > uint64(maxCatch) {
+				runs = uint64(maxCatch) + 1
+			}
+			n.overrun(behind, behind+1-runs)
+			next = next.Add(time.Duration(behind+1) * step)
+		case TickSlowDown:
+			n.overrun(behind, 0)
+			next = next.Add(step)
+		}
+		for i := uint64(0); i < runs; i++ {
+			select {
+			case <-n.done:
+				return
+			default:
+			}
+			n.events.run()
+			n.update(ins, step, i > 0)
+		}
+		if policy == TickSlowDown && time.Now().After(next) {
+			n.overrun(1, 0)
+			next = time.Now().Add(step)
+		}
+		step = n.step()
+		timer.Reset(time.Until(next))
+	}
+}
+
+func (n *Net) overrun(late, dropped uint64) {
+	if late == 0 {
+		return
+	}
+	n.mu.Lock()
+	n.sched.stats.Overruns += late
+	n.sched.stats.Dropped += dropped
+	n.mu.Unlock()
+}
+
+/*update runs a single Update, keeping the tick metadata and statistics*/
+func (n *Net) update(ins Instance, step time.Duration, catchUp bool) {
+	s := &n.sched
+	start := time.Now()
+	if !s.last.IsZero() {
+		s.tick.Elapsed = start.Sub(s.last)
+	}
+	s.last = start
+	s.tick.Step = step
+	s.tick.CatchUp = catchUp
+	n.mu.Lock()
+	s.tick.Overruns = s.stats.Overruns
+	n.mu.Unlock()
+
+	ins.Update()
+
+	d := time.Since(start)
+	n.mu.Lock()
+	st := &s.stats
+	if st.Count == 0 || d < st.Min {
+		st.Min = d
+	}
+	if d > st.Max {
+		st.Max = d
+	}
+	st.Count++
+	st.Last = d
+	s.total += d
+	st.Mean = s.total / time.Duration(st.Count)
+	n.mu.Unlock()
+	s.tick.Index++
+}
@@ -0,0 +1,63 @@
+package gna
+
+import (
+	"testing"
+	"time"
+)
+
+/*lateIns overruns its fourth tick by one and a half steps*/
+type lateIns struct {
+	Net
+	ticks []Tick
+}
+
+func (ins *lateIns) Auth(p *Player)    {}
+func (ins *lateIns) Disconn(p *Player) {}
+func (ins *lateIns) Update() {
+	tk := ins.Tick()
+	ins.ticks = append(ins.ticks, tk)
+	if tk.Index == 3 {
+		time.Sleep(5 * tk.Step / 2)
+	}
+	if tk.Index == 10 {
+		ins.Terminate()
+	}
+}
+
+func TestTickPolicies(t *testing.T) {
+	for _, policy := range []TickPolicy{TickDrop, TickCatchUp, TickSlowDown} {
+		ins := &lateIns{}
+		RunInstance(ins, WithTPS(100), WithTickPolicy(policy, 1))
+		st := ins.TickStats()
+		if st.Count != 11 || len(ins.ticks) != 11 {
+			t.Fatalf("policy %v: %d Updates, stats %+v", policy, len(ins.ticks), st)
+		}
+		catchUp := false
+		for i, tk := range ins.ticks {
+			if tk.Index != uint64(i) || tk.Step != 10*time.Millisecond {
+				t.Fatalf("policy %v: tick %d is %+v", policy, i, tk)
+			}
+			catchUp = catchUp || tk.CatchUp
+		}
+		if ins.ticks[10].Overruns == 0 || ins.ticks[10].Overruns > st.Overruns {
+			t.Errorf("policy %v: overruns %+v, last tick %+v", policy, st, ins.ticks[10])
+		}
+		if st.Max < 25*time.Millisecond || st.Min > st.Mean || st.Mean > st.Max || st.Last > st.Max {
+			t.Errorf("policy %v: durations %+v", policy, st)
+		}
+		switch policy {
+		case TickDrop:
+			if catchUp || st.Dropped != st.Overruns {
+				t.Errorf("TickDrop: %+v, catch up %v", st, catchUp)
+			}
+		case TickCatchUp:
+			if !catchUp || st.Dropped >= st.Overruns {
+				t.Errorf("TickCatchUp: %+v, catch up %v", st, catchUp)
+			}
+		case TickSlowDown:
+			if catchUp || st.Dropped != 0 {
+				t.Errorf("TickSlowDown: %+v, catch up %v", st, catchUp)
+			}
+		}
+	}
+}
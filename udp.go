@@ -0,0 +1,284 @@
+package gna
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+/*The unreliable channel is negotiated over the connection of the Player:
+the Client asks for it, the server answers with the UDP port and a random
+session token, and the Client greets the port until it gets an answer.
+Datagrams from the client carry:
+
+	uint64 player ID
+	uint64 session token
+	uint32 sequence number (0 for the greeting)
+	the message, encoded by the codec of the Player
+
+datagrams from the server carry only the sequence number and the message,
+a greeting answer has no message. Datagrams with a wrong token are ignored,
+as are the ones older than the last one received, late data is dropped
+instead of delivered out of order.
+*/
+
+const (
+	udpClientHeader = 20
+	udpServerHeader = 4
+	udpMaxDatagram  = 65507
+)
+
+/*ListenUDP opens the unreliable channel of the server, every Player whose
+Client asks for it gets a session on this address. Only the port is sent to
+the clients, the host is the same they used to connect.*/
+func (s *Server) ListenUDP(addr string) error {
+	uaddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", uaddr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.closing || s.udp != nil {
+		s.mu.Unlock()
+		conn.Close()
+		return errors.New("gna: cannot listen udp")
+	}
+	s.udp = conn
+	s.udpPlayers = make(map[uint64]*Player, 64)
+	s.mu.Unlock()
+	go s.udpLoop(conn)
+	return nil
+}
+
+/*udpSession is the state of the unreliable channel of a Player*/
+type udpSession struct {
+	token   uint64
+	addr    atomic.Pointer[net.UDPAddr] // nil until the greeting
+	recvSeq uint32                      // only used by the udp loop
+	sendSeq atomic.Uint32
+}
+
+/*offerUDP creates the session of the player, if the server has
+an unreliable channel and the codec of the player can frame messages*/
+func (s *Server) offerUDP(p *Player) udpOffer {
+	if _, ok := p.codec.(Framer); !ok {
+		return udpOffer{}
+	}
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return udpOffer{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.udp == nil {
+		return udpOffer{}
+	}
+	sess := &udpSession{token: binary.BigEndian.Uint64(b[:])}
+	p.udp.Store(sess)
+	s.udpPlayers[p.ID] = p
+	return udpOffer{
+		Port:  s.udp.LocalAddr().(*net.UDPAddr).Port,
+		ID:    p.ID,
+		Token: sess.token,
+	}
+}
+
+/*dropUDP removes the session of a disconnected player*/
+func (s *Server) dropUDP(p *Player) {
+	s.mu.Lock()
+	if s.udpPlayers != nil {
+		delete(s.udpPlayers, p.ID)
+	}
+	s.mu.Unlock()
+}
+
+func (s *Server) udpLoop(conn *net.UDPConn) {
+	buf := make([]byte, udpMaxDatagram)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		s.udpRecv(conn, buf[:n], addr)
+	}
+}
+
+func (s *Server) udpRecv(conn *net.UDPConn, b []byte, addr *net.UDPAddr) {
+	if len(b) < udpClientHeader {
+		return
+	}
+	id := binary.BigEndian.Uint64(b)
+	token := binary.BigEndian.Uint64(b[8:])
+	seq := binary.BigEndian.Uint32(b[16:])
+	s.mu.Lock()
+	p := s.udpPlayers[id]
+	s.mu.Unlock()
+	if p == nil {
+		return
+	}
+	sess := p.udp.Load()
+	if sess == nil || sess.token != token {
+		return
+	}
+	sess.addr.Store(addr)
+	if seq == 0 {
+		var ack [udpServerHeader]byte
+		conn.WriteToUDP(ack[:], addr)
+		return
+	}
+	if seq <= sess.recvSeq {
+		return
+	}
+	sess.recvSeq = seq
+	dt, err := p.decodeBytes(b[udpClientHeader:])
+	if err != nil || dt == nil || !p.allowsType(dt) {
+		return
+	}
+	if ok, err := p.throttleUnreliable(len(b) - udpClientHeader); !ok {
+		if err != nil {
+			p.setReason(DisconnectRateLimited)
+			p.Close()
+		}
+		return
+	}
+	if !p.accepts(dt) {
+		return
+	}
+	p.acu.add(&Input{p, dt})
+}
+
+/*shipUnreliable sends the data through the unreliable channel, if the player
+has one, otherwise it's queued only if there's room for it.*/
+func (p *Player) shipUnreliable(dt interface{}) {
+	sess := p.udp.Load()
+	if sess == nil || sess.addr.Load() == nil {
+		p.tryShip(Gameplay, dt)
+		return
+	}
+	b, ok := frameOf(p.codec, dt)
+	if !ok || len(b)+udpServerHeader > udpMaxDatagram {
+		p.tryShip(Gameplay, dt)
+		return
+	}
+	pkt := make([]byte, udpServerHeader, udpServerHeader+len(b))
+	binary.BigEndian.PutUint32(pkt, sess.sendSeq.Add(1))
+	p.srv.udp.WriteToUDP(append(pkt, b...), sess.addr.Load())
+}
+
+/*frameOf returns the encoded message, the data may already be a frame*/
+func frameOf(c Codec, dt interface{}) ([]byte, bool) {
+	if f, ok := dt.(*frame); ok {
+		return f.b, true
+	}
+	f, ok := c.(Framer)
+	if !ok {
+		return nil, false
+	}
+	b, err := f.Frame(dt)
+	return b, err == nil
+}
+
+/*udpClient is the client side of the unreliable channel*/
+type udpClient struct {
+	conn    *net.UDPConn
+	id      uint64
+	token   uint64
+	ready   atomic.Bool
+	sendSeq atomic.Uint32
+	recvSeq uint32 // only used by the reader
+}
+
+/*startUDP greets the server until it answers, up to a few seconds,
+and then reads the datagrams into the acumulator.*/
+func (c *Client) startUDP(offer udpOffer) {
+	tcp, ok := c.conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: tcp.IP, Port: offer.Port, Zone: tcp.Zone})
+	if err != nil {
+		return
+	}
+	u := &udpClient{conn: conn, id: offer.ID, token: offer.Token}
+	c.udp.Store(u)
+	go func() {
+		<-c.closedChan()
+		conn.Close()
+	}()
+	go c.udpReader(u)
+	for i := 0; i < 20 && !u.ready.Load(); i++ {
+		if _, err := conn.Write(u.header(0)); err != nil {
+			return
+		}
+		select {
+		case <-time.After(250 * time.Millisecond):
+		case <-c.closedChan():
+			return
+		}
+	}
+}
+
+func (u *udpClient) header(seq uint32) []byte {
+	b := make([]byte, udpClientHeader, 64)
+	binary.BigEndian.PutUint64(b, u.id)
+	binary.BigEndian.PutUint64(b[8:], u.token)
+	binary.BigEndian.PutUint32(b[16:], seq)
+	return b
+}
+
+func (c *Client) udpReader(u *udpClient) {
+	buf := make([]byte, udpMaxDatagram)
+	for {
+		n, err := u.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if n < udpServerHeader {
+			continue
+		}
+		seq := binary.BigEndian.Uint32(buf)
+		if n == udpServerHeader {
+			u.ready.Store(true)
+			continue
+		}
+		if seq <= u.recvSeq {
+			continue
+		}
+		u.recvSeq = seq
+		dt, err := c.decodeBytes(buf[udpServerHeader:n])
+		if err != nil || dt == nil || !c.accepts(dt) {
+			continue
+		}
+		c.acu.add(dt)
+	}
+}
+
+/*DispatchUnreliable sends the data through the unreliable channel, if it was
+negotiated (see WithUDP), otherwise it's dispatched through the connection
+only if that would not halt. Either way the data may be dropped.
+If used with a unstarted Client it panics.*/
+func (c *Client) DispatchUnreliable(data interface{}) {
+	if !c.started {
+		panic("cannot dispatch, client not started")
+	}
+	u := c.udp.Load()
+	if u != nil && u.ready.Load() {
+		if b, ok := frameOf(c.codec, data); ok && len(b)+udpClientHeader <= udpMaxDatagram {
+			u.conn.Write(append(u.header(u.sendSeq.Add(1)), b...))
+			return
+		}
+	}
+	c.tryShip(Gameplay, data)
+}
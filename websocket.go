@@ -0,0 +1,341 @@
+package gna
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*This is a minimal implementation of RFC 6455, just enough to carry the
+codec stream. Every Write becomes a single binary frame and, since the codecs
+write each message at once, every message arrives in a frame of its own.
+Fragmented and text frames are accepted when reading.
+*/
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+var errWSHandshake = errors.New("websocket: bad handshake")
+
+/*WebSocketHandler returns a http.Handler that upgrades the requests into
+WebSocket connections and hands the players to the Instance, exactly like
+a listener made with Listen: Auth, SetInstance and Disconn work the same for
+every player, regardless of the transport. Browsers usually speak JSON, so
+the codec of the handler may differ from the one of the Instance, if nil the
+codec of the Instance is used. The Instance is run with the server and the
+handler refuses connections while the server isn't serving.*/
+func (s *Server) WebSocketHandler(ins Instance, codec Codec) http.Handler {
+	l := &listener{mainIns: ins, srv: s, codec: codec}
+	s.addListener(l)
+	return l
+}
+
+func (l *listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !l.srv.isServing() {
+		http.Error(w, "server is not serving", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodGet ||
+		!headerHas(r.Header, "Connection", "upgrade") ||
+		!headerHas(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "expected a websocket upgrade", http.StatusBadRequest)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		wsAccept(key))
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return
+	}
+	l.accept(&wsConn{Conn: conn, br: rw.Reader})
+}
+
+/*dialWebSocket opens the connection and performs the client handshake*/
+func dialWebSocket(rawurl string, cfg *tls.Config) (net.Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+		conn, err = net.Dial("tcp", host)
+	case "wss":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: u.Hostname()}
+		}
+		conn, err = tls.Dial("tcp", host, cfg)
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c, err := wsHandshake(conn, u)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func wsHandshake(conn net.Conn, u *url.URL) (net.Conn, error) {
+	var nonce [16]byte
+	_, err := rand.Read(nonce[:])
+	if err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+	err = conn.SetDeadline(time.Now().Add(stdWriteTimeout))
+	if err != nil {
+		return nil, err
+	}
+	err = req.Write(conn)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		return nil, fmt.Errorf("%w: %v", errWSHandshake, resp.Status)
+	}
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return &wsConn{Conn: conn, br: br, client: true}, nil
+}
+
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*wsConn turns the WebSocket frames back into a stream,
+so the codecs can be used above it as with any other net.Conn*/
+type wsConn struct {
+	net.Conn
+	br     *bufio.Reader
+	client bool // clients must mask their frames
+
+	rem     uint64 // bytes left in the current data frame
+	mask    [4]byte
+	masked  bool
+	maskPos int
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for c.rem == 0 {
+		err := c.nextFrame()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if uint64(len(b)) > c.rem {
+		b = b[:c.rem]
+	}
+	n, err := c.br.Read(b)
+	if c.masked {
+		for i := 0; i < n; i++ {
+			b[i] ^= c.mask[c.maskPos&3]
+			c.maskPos++
+		}
+	}
+	c.rem -= uint64(n)
+	return n, err
+}
+
+/*nextFrame reads frame headers until a data frame is found,
+handling the control frames in the way*/
+func (c *wsConn) nextFrame() error {
+	var hdr [2]byte
+	_, err := io.ReadFull(c.br, hdr[:])
+	if err != nil {
+		return err
+	}
+	op := hdr[0] & 0x0F
+	c.masked = hdr[1]&0x80 != 0
+	size := uint64(hdr[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if c.masked {
+		if _, err = io.ReadFull(c.br, c.mask[:]); err != nil {
+			return err
+		}
+	}
+	c.maskPos = 0
+	switch op {
+	case wsContinuation, wsText, wsBinary:
+		c.rem = size
+		return nil
+	case wsClose, wsPing, wsPong:
+		if size > 125 {
+			return errors.New("websocket: control frame too big")
+		}
+		payload := make([]byte, size)
+		if _, err = io.ReadFull(c.br, payload); err != nil {
+			return err
+		}
+		if c.masked {
+			for i := range payload {
+				payload[i] ^= c.mask[i&3]
+			}
+		}
+		switch op {
+		case wsClose:
+			c.writeFrame(wsClose, payload)
+			return io.EOF
+		case wsPing:
+			return c.writeFrame(wsPong, payload)
+		}
+		return nil
+	}
+	return fmt.Errorf("websocket: unknown opcode %v", op)
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	err := c.writeFrame(wsBinary, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	buf := make([]byte, 0, 14+len(payload))
+	buf = append(buf, 0x80|op)
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		buf = append(buf, maskBit|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(payload)))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(len(payload)))
+	}
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		buf = append(buf, mask[:]...)
+		for i, b := range payload {
+			buf = append(buf, b^mask[i&3])
+		}
+	} else {
+		buf = append(buf, payload...)
+	}
+	_, err := c.Conn.Write(buf)
+	return err
+}
+
+/*Close sends the close frame, if possible, and closes the connection*/
+func (c *wsConn) Close() error {
+	c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.writeFrame(wsClose, nil)
+	c.wmu.Lock()
+	c.closed = true
+	c.wmu.Unlock()
+	return c.Conn.Close()
+}
@@ -0,0 +1,181 @@
+package gna
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+/*wsPipe returns the two ends of a WebSocket connection over a pipe*/
+func wsPipe() (client, server *wsConn) {
+	c, s := net.Pipe()
+	client = &wsConn{Conn: c, br: bufio.NewReader(c), client: true}
+	server = &wsConn{Conn: s, br: bufio.NewReader(s)}
+	return client, server
+}
+
+func TestWSAccept(t *testing.T) {
+	// the example of RFC 6455, section 1.3
+	if got := wsAccept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatal(got)
+	}
+}
+
+func TestWSFrames(t *testing.T) {
+	// one size for each length encoding, and its edges
+	sizes := []int{0, 1, 125, 126, 0xFFFF, 0x10000}
+	for _, dir := range []string{"client", "server"} {
+		t.Run(dir, func(t *testing.T) {
+			client, server := wsPipe()
+			defer client.Conn.Close()
+			defer server.Conn.Close()
+			w, r := client, server
+			if dir == "server" {
+				w, r = server, client
+			}
+			go func() {
+				for _, n := range sizes {
+					w.Write(bytes.Repeat([]byte{byte(n)}, n))
+				}
+			}()
+			for _, n := range sizes {
+				if n == 0 {
+					continue // an empty frame carries nothing to read
+				}
+				got := make([]byte, n)
+				if _, err := io.ReadFull(r, got); err != nil {
+					t.Fatalf("%d bytes: %v", n, err)
+				}
+				if !bytes.Equal(got, bytes.Repeat([]byte{byte(n)}, n)) {
+					t.Fatalf("%d bytes: payload changed", n)
+				}
+			}
+		})
+	}
+}
+
+func TestWSMasking(t *testing.T) {
+	for _, client := range []bool{true, false} {
+		c, s := net.Pipe()
+		w := &wsConn{Conn: c, br: bufio.NewReader(c), client: client}
+		payload := bytes.Repeat([]byte("gna"), 20)
+		go w.Write(payload)
+		raw := make([]byte, 2+len(payload))
+		if client {
+			raw = make([]byte, 6+len(payload))
+		}
+		if _, err := io.ReadFull(s, raw); err != nil {
+			t.Fatal(err)
+		}
+		if raw[0] != 0x80|wsBinary {
+			t.Fatalf("header %#x", raw[0])
+		}
+		masked := raw[1]&0x80 != 0
+		if masked != client {
+			t.Fatalf("client %v, masked %v", client, masked)
+		}
+		if int(raw[1]&0x7F) != len(payload) {
+			t.Fatalf("length %d", raw[1]&0x7F)
+		}
+		body := raw[2:]
+		if client {
+			mask := raw[2:6]
+			body = raw[6:]
+			for i := range body {
+				body[i] ^= mask[i&3]
+			}
+		}
+		if !bytes.Equal(body, payload) {
+			t.Fatalf("client %v: payload %q", client, body)
+		}
+		c.Close()
+		s.Close()
+	}
+}
+
+func TestWSControlFrames(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	server := &wsConn{Conn: s, br: bufio.NewReader(s)}
+	read := make(chan []byte, 1)
+	go func() {
+		b := make([]byte, 5)
+		_, err := io.ReadFull(server, b)
+		if err != nil {
+			b = nil
+		}
+		read <- b
+	}()
+	// a masked ping in the middle of a message split in two frames
+	mask := []byte{1, 2, 3, 4}
+	frame := func(op byte, fin bool, payload string) []byte {
+		b := []byte{op, 0x80 | byte(len(payload))}
+		if fin {
+			b[0] |= 0x80
+		}
+		b = append(b, mask...)
+		for i := range payload {
+			b = append(b, payload[i]^mask[i&3])
+		}
+		return b
+	}
+	c.Write(frame(wsText, false, "he"))
+	c.Write(frame(wsPing, true, "hi"))
+	pong := make([]byte, 4)
+	if _, err := io.ReadFull(c, pong); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pong, []byte{0x80 | wsPong, 2, 'h', 'i'}) {
+		t.Fatalf("pong %q", pong)
+	}
+	c.Write(frame(wsContinuation, true, "llo"))
+	if got := <-read; string(got) != "hello" {
+		t.Fatalf("got %q", got)
+	}
+
+	go c.Write(frame(wsClose, true, ""))
+	go io.Copy(io.Discard, c) // the close frame sent back
+	if _, err := server.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatal(err)
+	}
+}
+
+/*certIns reports the certificate of each player in Auth*/
+type certIns struct {
+	testIns
+	certs chan *x509.Certificate
+}
+
+func (ins *certIns) Auth(p *Player) { ins.certs <- p.PeerCertificate() }
+
+func TestWSPeerCertificate(t *testing.T) {
+	ins := &certIns{certs: make(chan *x509.Certificate, 1)}
+	srv := NewServer()
+	ts := httptest.NewUnstartedServer(srv.WebSocketHandler(ins, nil))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+	go srv.Serve(context.Background())
+	defer srv.Shutdown(context.Background())
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	cfg := &tls.Config{RootCAs: pool, Certificates: ts.TLS.Certificates}
+	c, err := DialWebSocket("wss"+strings.TrimPrefix(ts.URL, "https"), WithTLS(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	cert := <-ins.certs
+	if cert == nil || !cert.Equal(ts.Certificate()) {
+		t.Fatal("no peer certificate for a wss player")
+	}
+}